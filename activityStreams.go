@@ -24,15 +24,19 @@ package sdk
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 /*
  GetActivityStreams returns All Activity streams passed in request.
+ The map is empty when the node cannot be reached.
  host:http://ip:port
 */
 func GetActivityStreams(host string, ids []string) map[string]interface{} {
@@ -94,63 +98,84 @@ func GetActivityStream(host string, id string) map[string]interface{} {
 
 /*
  GetActivityStreamVolatile returns the passed activity stream volatile .
+ Encrypted volatiles are decrypted, see SetVolatileEncryption.
+ The map is empty when the volatile cannot be read or decrypted,
+ ReadActivityStreamVolatile reports why.
  host:http://ip:port
 */
 func GetActivityStreamVolatile(host string, id string) map[string]interface{} {
 
-	u, err := url.Parse(host)
-	if err != nil {
-		log.Fatal(err)
-	}
-	rel, err := u.Parse("/api/stream/" + id + "/volatile")
+	result, err := ReadActivityStreamVolatile(context.Background(), host, id)
 	if err != nil {
-		log.Fatal(err)
+		return make(map[string]interface{})
 	}
 
-	req, _ := http.Get(rel.String())
-	req.Header.Set("Content-Type", "application/json")
-	defer req.Body.Close()
+	return result
+}
 
-	bdy, _ := ioutil.ReadAll(req.Body)
+/*
+ ReadActivityStreamVolatile returns the passed activity stream volatile like
+ GetActivityStreamVolatile, with the error when it cannot be read or decrypted.
+ host:http://ip:port
+*/
+func ReadActivityStreamVolatile(ctx context.Context, host string, id string) (map[string]interface{}, error) {
+
+	var body json.RawMessage
+	if err := getJSON(ctx, nil, host, "/api/stream/"+url.PathEscape(id)+"/volatile", nil, &body); err != nil {
+		return nil, err
+	}
+	bdy, err := openVolatileBody(id, body)
+	if err != nil {
+		return nil, err
+	}
 
 	var result map[string]interface{}
-	json.Unmarshal([]byte(bdy), &result)
+	if err := json.Unmarshal(bdy, &result); err != nil {
+		return nil, err
+	}
 
-	return result
+	return result, nil
 }
 
 /*
  SetActivityStreamVolatile sets the passed activity stream id volatiles.
+ They are encrypted first when SetVolatileEncryption is on.
+ The map is empty when the volatile cannot be encrypted or the node cannot
+ be reached, WriteActivityStreamVolatile reports why.
  host:http://ip:port
 
 */
 func SetActivityStreamVolatile(host string, id string, bdy interface{}) map[string]interface{} {
 
-	bdyJSON, _ := json.Marshal(bdy)
-	u, err := url.Parse(host)
-	if err != nil {
-		log.Fatal(err)
-	}
-	rel, err := u.Parse("/api/stream/" + id + "/volatile")
+	r, err := WriteActivityStreamVolatile(context.Background(), host, id, bdy)
 	if err != nil {
-		log.Fatal(err)
+		return make(map[string]interface{})
 	}
 
-	req, _ := http.NewRequest("POST", rel.String(), bytes.NewBuffer(bdyJSON))
-
-	req.Header.Set("Content-Type", "application/json")
+	return r
+}
 
-	client := &http.Client{}
-	resp, _ := client.Do(req)
+/*
+ WriteActivityStreamVolatile sets the passed activity stream id volatiles like
+ SetActivityStreamVolatile, with the error when they cannot be written.
+ host:http://ip:port
+*/
+func WriteActivityStreamVolatile(ctx context.Context, host string, id string, bdy interface{}) (map[string]interface{}, error) {
 
-	defer resp.Body.Close()
+	sealed, err := sealVolatile(id, bdy)
+	if err != nil {
+		return nil, err
+	}
 
-	txResp, _ := ioutil.ReadAll(resp.Body)
+	var txResp json.RawMessage
+	if err := postJSON(ctx, nil, host, "/api/stream/"+url.PathEscape(id)+"/volatile", sealed, &txResp); err != nil {
+		return nil, err
+	}
 
 	r := make(map[string]interface{})
 	_ = json.Unmarshal(txResp, &r)
 
-	return r
+	return r, nil
 }
 
 /*
@@ -182,6 +207,7 @@ func GetActivityStreamChanges(host string) map[string]interface{} {
 
 /*
  SearchActivityStreamPost runs the passed query on Activeledger and returns the resposne.
+ The map is empty when the node cannot be reached.
  host:http://ip:port
 
 */
@@ -272,3 +298,98 @@ func FindTransaction(host string, umid string) map[string]interface{} {
 
 	return result
 }
+
+// getJSON fetches path from host and decodes the JSON response into out,
+// reporting transport errors and unexpected status codes.
+func getJSON(ctx context.Context, client *http.Client, host string, path string, query url.Values, out interface{}) error {
+	u, err := url.Parse(host)
+	if err != nil {
+		return err
+	}
+	rel, err := u.Parse(path)
+	if err != nil {
+		return err
+	}
+	if query != nil {
+		rel.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rel.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(client, req, out)
+}
+
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// HTTPError is returned when a node answers with an unexpected status code.
+type HTTPError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%s: got response status code %d", e.URL, e.StatusCode)
+}
+
+// fetchStream reads a stream document, unwrapping the "stream" envelope the
+// node puts around it.
+func fetchStream(ctx context.Context, client *http.Client, host string, id string) (map[string]json.RawMessage, error) {
+	var body map[string]json.RawMessage
+	if err := getJSON(ctx, client, host, "/api/stream/"+url.PathEscape(id), nil, &body); err != nil {
+		return nil, err
+	}
+	return unwrapStream(body)
+}
+
+// unwrapStream returns the document inside a "stream" envelope, or body
+// itself when there is none.
+func unwrapStream(body map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	if inner, ok := body["stream"]; ok && strings.HasPrefix(string(inner), "{") {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(inner, &doc); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+	return body, nil
+}
+
+// postJSON posts body as JSON to path on host and decodes the JSON response into out.
+func postJSON(ctx context.Context, client *http.Client, host string, path string, body interface{}, out interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return err
+	}
+	rel, err := u.Parse(path)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", rel.String(), bytes.NewBuffer(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doJSON(client, req, out)
+}
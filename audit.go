@@ -0,0 +1,245 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// SignatureCheck is the result of verifying one $sigs entry of a transaction.
+type SignatureCheck struct {
+	// Signer is the identity stream ID, or the input name for self signed
+	// transactions such as onboarding.
+	Signer   string `json:"signer"`
+	KeyType  string `json:"keyType,omitempty"`
+	Verified bool   `json:"verified"`
+	// Error explains why the signature did not verify.
+	Error string `json:"error,omitempty"`
+}
+
+// AuditEntry is one transaction in a stream's history.
+type AuditEntry struct {
+	Revision   string           `json:"revision"`
+	UMID       string           `json:"umid"`
+	Committed  time.Time        `json:"committed"`
+	Namespace  string           `json:"namespace,omitempty"`
+	Contract   string           `json:"contract,omitempty"`
+	Entry      string           `json:"entry,omitempty"`
+	Signatures []SignatureCheck `json:"signatures"`
+	// Error is set when the transaction could not be read.
+	Error string `json:"error,omitempty"`
+}
+
+// Verified reports whether the transaction was read and every signature on
+// it verified.
+func (e AuditEntry) Verified() bool {
+	if e.Error != "" || len(e.Signatures) == 0 {
+		return false
+	}
+	for _, s := range e.Signatures {
+		if !s.Verified {
+			return false
+		}
+	}
+	return true
+}
+
+// AuditReport is the transaction history of a stream, oldest first.
+type AuditReport struct {
+	StreamID  string       `json:"streamId"`
+	Generated time.Time    `json:"generated"`
+	Entries   []AuditEntry `json:"entries"`
+}
+
+/*
+AuditStream reconstructs the transaction history of a stream. It walks the
+stream's revisions, see StreamRevisions, reads the transaction behind each
+and verifies every signature on it against the public key onboarded on the
+signer's identity stream, or carried in the transaction when it is self
+signed. Signatures are checked over $tx exactly as the node returns it.
+host:http://ip:port
+*/
+func AuditStream(ctx context.Context, host string, id string) (*AuditReport, error) {
+	revs, err := StreamRevisions(ctx, host, id)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &AuditReport{StreamID: id, Generated: time.Now().UTC()}
+	identities := make(map[string]identityKey)
+	for _, r := range revs {
+		entry := AuditEntry{Revision: r.Revision, UMID: r.UMID, Committed: r.Committed}
+		if r.UMID == "" {
+			entry.Error = "transaction not reported by the node"
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+
+		record, err := fetchTransaction(ctx, host, r.UMID)
+		if errors.Is(err, ErrTransactionNotFound) {
+			entry.Error = "transaction not found"
+			report.Entries = append(report.Entries, entry)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := auditTransaction(ctx, host, record, identities, &entry); err != nil {
+			return nil, err
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+	return report, nil
+}
+
+// identityKey is the public key of a signer.
+type identityKey struct {
+	keyType string
+	pem     string
+	err     error
+}
+
+// auditTransaction fills entry from a transaction record and checks its
+// signatures. identities caches the keys of identity streams already read.
+func auditTransaction(ctx context.Context, host string, record *TransactionRecord, identities map[string]identityKey, entry *AuditEntry) error {
+	if _, bad := record.Extra["$tx"]; bad {
+		entry.Error = "malformed $tx"
+		return nil
+	}
+	if _, bad := record.Extra["$sigs"]; bad {
+		entry.Error = "unsupported $sigs format"
+		return nil
+	}
+	entry.Namespace, entry.Contract, entry.Entry = record.Tx.Namespace, record.Tx.Contract, record.Tx.Entry
+
+	var signed bytes.Buffer
+	if err := json.Compact(&signed, record.RawTx); err != nil {
+		return err
+	}
+
+	signers := make([]string, 0, len(record.Signatures))
+	for signer := range record.Signatures {
+		signers = append(signers, signer)
+	}
+	sort.Strings(signers)
+
+	for _, signer := range signers {
+		check := SignatureCheck{Signer: signer}
+		var key identityKey
+		if record.SelfSign {
+			key = inputKey(record.Tx.Input[signer])
+		} else {
+			var ok bool
+			if key, ok = identities[signer]; !ok {
+				key = fetchIdentityKey(ctx, host, signer)
+				identities[signer] = key
+			}
+		}
+		check.KeyType = key.keyType
+
+		if key.err != nil {
+			check.Error = key.err.Error()
+		} else if err := VerifyPem(key.keyType, key.pem, signed.Bytes(), record.Signatures[signer]); err != nil {
+			check.Error = err.Error()
+		} else {
+			check.Verified = true
+		}
+		entry.Signatures = append(entry.Signatures, check)
+	}
+	return nil
+}
+
+// inputKey reads the public key a self signed transaction carries in its
+// input, as onboarding does.
+func inputKey(input interface{}) identityKey {
+	fields, _ := input.(map[string]interface{})
+	key := identityKey{}
+	key.keyType, _ = fields["type"].(string)
+	if key.pem, _ = fields["publicKey"].(string); key.pem == "" {
+		key.pem, _ = fields["public"].(string)
+	}
+	if key.pem == "" {
+		key.err = errors.New("no public key in transaction input")
+	}
+	return key
+}
+
+// fetchIdentityKey reads the public key and key type the onboard contract
+// stored on an identity stream.
+func fetchIdentityKey(ctx context.Context, host string, id string) identityKey {
+	doc, err := fetchStream(ctx, http.DefaultClient, host, id)
+	if err != nil {
+		return identityKey{err: fmt.Errorf("identity %s: %w", id, err)}
+	}
+	key := identityKey{keyType: stringField(doc, "type"), pem: stringField(doc, "public", "publicKey")}
+	if key.pem == "" {
+		key.err = fmt.Errorf("identity %s has no public key", id)
+	}
+	return key
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *AuditReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV writes the report with a header and one row per signature, or a
+// single row for a transaction without any.
+func (r *AuditReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"stream", "revision", "umid", "committed", "namespace", "contract", "entry", "signer", "key_type", "verified", "error"})
+
+	for _, e := range r.Entries {
+		committed := ""
+		if !e.Committed.IsZero() {
+			committed = e.Committed.UTC().Format(time.RFC3339)
+		}
+		row := []string{r.StreamID, e.Revision, e.UMID, committed, e.Namespace, e.Contract, e.Entry}
+
+		if len(e.Signatures) == 0 {
+			cw.Write(append(row, "", "", "false", e.Error))
+			continue
+		}
+		for _, s := range e.Signatures {
+			reason := s.Error
+			if reason == "" {
+				reason = e.Error
+			}
+			cw.Write(append(row[:len(row):len(row)], s.Signer, s.KeyType, strconv.FormatBool(s.Verified), reason))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
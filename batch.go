@@ -0,0 +1,134 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDependencyFailed is the error of a transaction skipped because an
+// earlier transaction on one of its streams failed, see BatchOptions.
+var ErrDependencyFailed = errors.New("earlier transaction on the same stream failed")
+
+// BatchOptions configures SendBatch.
+type BatchOptions struct {
+	// Concurrency is the number of transactions in flight at once, 8 when
+	// zero.
+	Concurrency int
+	// SkipAfterError skips the remaining transactions on a stream once one
+	// of them fails, instead of sending them anyway.
+	SkipAfterError bool
+	// OnResult, when set, is called as each transaction finishes. It may be
+	// called from several goroutines at once.
+	OnResult func(BatchResult)
+}
+
+// BatchResult is the outcome of one transaction of a batch.
+type BatchResult struct {
+	// Index is the transaction's position in the batch.
+	Index    int
+	Response Response
+	Err      error
+}
+
+/*
+SendBatch sends transactions concurrently, up to opts.Concurrency at a time.
+Transactions reading or writing the same stream are sent strictly in batch
+order, each only once the one before it has been answered, since concurrent
+writes to a stream conflict. The results are returned in batch order.
+
+Cancelling ctx stops transactions not sent yet, which report ctx's error;
+those already in flight are still answered.
+host:http://ip:port
+*/
+func SendBatch(ctx context.Context, host string, transactions []Transaction, opts BatchOptions) []BatchResult {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+
+	results := make([]BatchResult, len(transactions))
+	done := make([]chan struct{}, len(transactions))
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+
+	// each transaction waits for the previous one on each of its streams
+	deps := make([][]int, len(transactions))
+	last := make(map[string]int)
+	for i, tx := range transactions {
+		for _, stream := range affectedStreams(tx) {
+			if prev, ok := last[stream]; ok {
+				deps[i] = append(deps[i], prev)
+			}
+			last[stream] = i
+		}
+	}
+
+	slots := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i := range transactions {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(done[i])
+			results[i] = sendInBatch(ctx, host, transactions[i], deps[i], done, results, slots, opts)
+			results[i].Index = i
+			if opts.OnResult != nil {
+				opts.OnResult(results[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// sendInBatch waits for a transaction's dependencies and a free slot, then
+// sends it. results[d] may be read once done[d] is closed.
+func sendInBatch(ctx context.Context, host string, tx Transaction, deps []int, done []chan struct{}, results []BatchResult, slots chan struct{}, opts BatchOptions) BatchResult {
+	for _, d := range deps {
+		select {
+		case <-done[d]:
+		case <-ctx.Done():
+			return BatchResult{Err: ctx.Err()}
+		}
+		if opts.SkipAfterError && results[d].Err != nil {
+			return BatchResult{Err: ErrDependencyFailed}
+		}
+	}
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return BatchResult{Err: ctx.Err()}
+	}
+	defer func() { <-slots }()
+
+	// a slot and a cancellation may be ready together
+	if err := ctx.Err(); err != nil {
+		return BatchResult{Err: err}
+	}
+	resp, err := SendTransaction(tx, host)
+	return BatchResult{Response: resp, Err: err}
+}
@@ -0,0 +1,343 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamChange is one change to an activity stream.
+type StreamChange struct {
+	// Seq is the change's position in the changes feed, empty for changes
+	// received as events.
+	Seq      string
+	StreamID string
+	Revision string
+	UMID     string
+	// Stream is the stream document after the change, when the node sent it.
+	Stream json.RawMessage
+}
+
+// Generation is the numeric prefix of the change's revision, which grows
+// with every change to a stream. It is 0 when the revision is unknown.
+func (c StreamChange) Generation() int {
+	return revGeneration(c.Revision)
+}
+
+func revGeneration(rev string) int {
+	i := strings.IndexByte(rev, '-')
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(rev[:i])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Change converts an activity event to a StreamChange.
+func (a ActivityEvent) Change() StreamChange {
+	return StreamChange{StreamID: a.StreamID, Revision: a.Revision, UMID: a.UMID, Stream: a.Stream}
+}
+
+// changesPage is a page of the /api/stream/changes feed. Nodes answer with
+// either a "changes" or a "results" list.
+type changesPage struct {
+	Changes []json.RawMessage `json:"changes"`
+	Results []json.RawMessage `json:"results"`
+	LastSeq json.RawMessage   `json:"last_seq"`
+}
+
+// changeRecord is a single entry of the changes feed.
+type changeRecord struct {
+	Seq     json.RawMessage            `json:"seq"`
+	ID      string                     `json:"id"`
+	Rev     string                     `json:"rev"`
+	Changes []struct{ Rev string }     `json:"changes"`
+	Doc     map[string]json.RawMessage `json:"doc"`
+}
+
+// seqString reads a sequence which may be sent as a JSON string or number.
+func seqString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func (r changeRecord) change() (StreamChange, error) {
+	c := StreamChange{Seq: seqString(r.Seq), StreamID: r.ID, Revision: r.Rev}
+	if c.Revision == "" && len(r.Changes) > 0 {
+		c.Revision = r.Changes[0].Rev
+	}
+	if r.Doc != nil {
+		if c.StreamID == "" {
+			c.StreamID = stringField(r.Doc, "_id")
+		}
+		if c.Revision == "" {
+			c.Revision = stringField(r.Doc, "_rev")
+		}
+		c.UMID = stringField(r.Doc, "$umid", "umid")
+
+		var err error
+		if c.Stream, err = json.Marshal(r.Doc); err != nil {
+			return StreamChange{}, err
+		}
+	}
+	return c, nil
+}
+
+// fetchChanges reads one page of the changes feed after since, returning
+// the changes and the sequence to continue from.
+func fetchChanges(ctx context.Context, client *http.Client, host string, query url.Values) ([]StreamChange, string, error) {
+	var page changesPage
+	if err := getJSON(ctx, client, host, "/api/stream/changes", query, &page); err != nil {
+		return nil, "", err
+	}
+
+	records := page.Changes
+	if records == nil {
+		records = page.Results
+	}
+
+	changes := make([]StreamChange, 0, len(records))
+	for _, raw := range records {
+		var r changeRecord
+		if err := json.Unmarshal(raw, &r); err != nil {
+			return nil, "", err
+		}
+		c, err := r.change()
+		if err != nil {
+			return nil, "", err
+		}
+		changes = append(changes, c)
+	}
+
+	lastSeq := ""
+	if len(page.LastSeq) > 0 {
+		lastSeq = seqString(page.LastSeq)
+	} else if len(changes) > 0 {
+		lastSeq = changes[len(changes)-1].Seq
+	}
+	return changes, lastSeq, nil
+}
+
+// feedPosition returns the sequence at the current end of the changes feed.
+// It asks for the changes since "now", and falls back to the newest change
+// for nodes which do not understand that.
+func feedPosition(ctx context.Context, client *http.Client, host string) (string, error) {
+	changes, lastSeq, err := fetchChanges(ctx, client, host, url.Values{"since": {"now"}, "limit": {"1"}})
+	// a node ignoring since=now answers with the start of the feed
+	if err == nil && len(changes) == 0 && lastSeq != "" && lastSeq != "now" {
+		return lastSeq, nil
+	}
+
+	changes, lastSeq, err = fetchChanges(ctx, client, host, url.Values{"descending": {"true"}, "limit": {"1"}})
+	if err != nil {
+		return "", err
+	}
+	if len(changes) > 0 && changes[0].Seq != "" {
+		return changes[0].Seq, nil
+	}
+	if lastSeq == "" {
+		// an empty feed
+		return "0", nil
+	}
+	return lastSeq, nil
+}
+
+// changesQuery builds the query for a page of the changes feed.
+func changesQuery(since string, limit int) url.Values {
+	q := url.Values{}
+	q.Set("include_docs", "true")
+	if since != "" {
+		q.Set("since", since)
+	}
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+	return q
+}
+
+// ChangesOptions configures a ChangesIterator.
+type ChangesOptions struct {
+	// Since is the sequence to start after, the start of the feed when empty.
+	Since string
+	// Limit is the number of changes fetched per request, 100 when zero.
+	Limit int
+	// StreamIDs limits the changes to these streams.
+	StreamIDs []string
+	// Filter, when set, drops the changes it returns false for.
+	Filter func(StreamChange) bool
+	// Continuous keeps waiting for new changes once the feed is caught up,
+	// long-polling the node, instead of ending the iteration.
+	Continuous bool
+	// PollInterval is the pause between polls which return no changes in
+	// continuous mode, 1s when zero.
+	PollInterval time.Duration
+	// Client makes the requests, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// ChangesIterator reads the /api/stream/changes feed a page at a time.
+//
+//	it := sdk.StreamChanges(ctx, host, sdk.ChangesOptions{Since: saved})
+//	for it.Next() {
+//		change := it.Change()
+//	}
+//	saved = it.LastSeq()
+type ChangesIterator struct {
+	ctx     context.Context
+	host    string
+	opts    ChangesOptions
+	streams map[string]bool
+
+	page    []StreamChange
+	pageSeq string
+	change  StreamChange
+	lastSeq string
+	err     error
+	done    bool
+	last    bool
+}
+
+// StreamChanges iterates over the changes feed of the node at host,
+// host:http://ip:port
+func StreamChanges(ctx context.Context, host string, opts ChangesOptions) *ChangesIterator {
+	if opts.Limit <= 0 {
+		opts.Limit = 100
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	it := &ChangesIterator{ctx: ctx, host: host, opts: opts, pageSeq: opts.Since, lastSeq: opts.Since}
+	if len(opts.StreamIDs) > 0 {
+		it.streams = make(map[string]bool, len(opts.StreamIDs))
+		for _, id := range opts.StreamIDs {
+			it.streams[id] = true
+		}
+	}
+	return it
+}
+
+// Next advances to the next change. It returns false once the feed is
+// exhausted, or in continuous mode when ctx is done, or on error.
+func (it *ChangesIterator) Next() bool {
+	for !it.done {
+		if len(it.page) > 0 {
+			it.change = it.page[0]
+			it.page = it.page[1:]
+			if it.change.Seq != "" {
+				it.lastSeq = it.change.Seq
+			}
+			if it.streams != nil && !it.streams[it.change.StreamID] {
+				continue
+			}
+			if it.opts.Filter != nil && !it.opts.Filter(it.change) {
+				continue
+			}
+			return true
+		}
+
+		// everything up to the end of the page has been seen
+		it.lastSeq = it.pageSeq
+		if !it.fetch() {
+			it.done = true
+		}
+	}
+	return false
+}
+
+// fetch reads the next page, waiting for changes in continuous mode. It
+// returns false when the iteration is over.
+func (it *ChangesIterator) fetch() bool {
+	for !it.last {
+		q := changesQuery(it.pageSeq, it.opts.Limit)
+		if it.opts.Continuous {
+			q.Set("feed", "longpoll")
+		}
+
+		changes, lastSeq, err := fetchChanges(it.ctx, it.opts.Client, it.host, q)
+		if err != nil {
+			if !it.opts.Continuous || it.ctx.Err() == nil {
+				it.err = err
+			}
+			return false
+		}
+
+		advanced := lastSeq != "" && lastSeq != it.pageSeq
+		if lastSeq != "" {
+			it.pageSeq = lastSeq
+		}
+
+		if !it.opts.Continuous {
+			// a short page, or one the feed cannot move past, is the end
+			it.last = !advanced || len(changes) < it.opts.Limit
+			if len(changes) > 0 {
+				it.page = changes
+				return true
+			}
+			continue
+		}
+
+		if advanced && len(changes) > 0 {
+			it.page = changes
+			return true
+		}
+		select {
+		case <-time.After(it.opts.PollInterval):
+		case <-it.ctx.Done():
+			return false
+		}
+	}
+	return false
+}
+
+// Change returns the current change.
+func (it *ChangesIterator) Change() StreamChange {
+	return it.change
+}
+
+// LastSeq returns the sequence to resume from: that of the last change
+// returned by Next, or the end of the feed read so far once every change
+// before it has been returned or filtered out.
+func (it *ChangesIterator) LastSeq() string {
+	return it.lastSeq
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ChangesIterator) Err() error {
+	return it.err
+}
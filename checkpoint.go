@@ -0,0 +1,162 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// CheckpointStore records the last processed event ID of each subscription
+// so a consumer can resume where it stopped after a restart.
+type CheckpointStore interface {
+	// Load returns the saved event ID for key, "" when there is none.
+	Load(key string) (string, error)
+	Save(key string, eventID string) error
+}
+
+// MemoryCheckpointStore keeps checkpoints for the life of the process.
+type MemoryCheckpointStore struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+// NewMemoryCheckpointStore creates an empty in-memory store.
+func NewMemoryCheckpointStore() *MemoryCheckpointStore {
+	return &MemoryCheckpointStore{ids: make(map[string]string)}
+}
+
+func (m *MemoryCheckpointStore) Load(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ids[key], nil
+}
+
+func (m *MemoryCheckpointStore) Save(key string, eventID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ids[key] = eventID
+	return nil
+}
+
+// FileCheckpointStore keeps checkpoints in a JSON file. Every Save rewrites
+// the file atomically, so a crash leaves either the old or the new checkpoint.
+type FileCheckpointStore struct {
+	path string
+	mu   sync.Mutex
+	ids  map[string]string
+}
+
+// NewFileCheckpointStore opens the store at path, creating it on first Save.
+func NewFileCheckpointStore(path string) (*FileCheckpointStore, error) {
+	f := &FileCheckpointStore{path: path, ids: make(map[string]string)}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &f.ids); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileCheckpointStore) Load(key string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ids[key], nil
+}
+
+func (f *FileCheckpointStore) Save(key string, eventID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prev, had := f.ids[key]
+	f.ids[key] = eventID
+	if err := f.write(); err != nil {
+		if had {
+			f.ids[key] = prev
+		} else {
+			delete(f.ids, key)
+		}
+		return err
+	}
+	return nil
+}
+
+func (f *FileCheckpointStore) write() error {
+	b, err := json.Marshal(f.ids)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
+
+// recentIDs remembers the last few event IDs seen, to drop events a node
+// replays after a resume.
+type recentIDs struct {
+	ids  map[string]struct{}
+	ring []string
+	next int
+}
+
+func newRecentIDs(size int) *recentIDs {
+	return &recentIDs{ids: make(map[string]struct{}, size), ring: make([]string, size)}
+}
+
+// Add records id and reports whether it was new.
+func (r *recentIDs) Add(id string) bool {
+	if _, ok := r.ids[id]; ok {
+		return false
+	}
+	if old := r.ring[r.next]; old != "" {
+		delete(r.ids, old)
+	}
+	r.ring[r.next] = id
+	r.next = (r.next + 1) % len(r.ring)
+	r.ids[id] = struct{}{}
+	return true
+}
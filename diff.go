@@ -0,0 +1,271 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is one operation of an RFC 6902 JSON Patch.
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	// old is the value a remove or replace overwrote, for String.
+	old json.RawMessage
+}
+
+// Patch is an RFC 6902 JSON Patch. Applied in order to the first document
+// it turns it into the second.
+type Patch []PatchOp
+
+// String renders the patch one change per line, for people to read.
+func (p Patch) String() string {
+	var b strings.Builder
+	for _, op := range p {
+		path := op.Path
+		if path == "" {
+			path = "(root)"
+		}
+		switch op.Op {
+		case "add":
+			fmt.Fprintf(&b, "added   %s = %s\n", path, op.Value)
+		case "remove":
+			fmt.Fprintf(&b, "removed %s (was %s)\n", path, op.old)
+		case "replace":
+			fmt.Fprintf(&b, "changed %s: %s -> %s\n", path, op.old, op.Value)
+		}
+	}
+	return b.String()
+}
+
+// DiffJSON compares two JSON documents and returns the patch turning from
+// into to. Numbers are compared by exact value, so 1 and 1.0 are equal
+// but large integers differing past float64 precision are not.
+func DiffJSON(from json.RawMessage, to json.RawMessage) (Patch, error) {
+	a, err := decodeNumbers(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := decodeNumbers(to)
+	if err != nil {
+		return nil, err
+	}
+	var p Patch
+	if err := diffValues(&p, "", a, b); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// DiffStreams compares the state of two streams, such as the same stream at
+// two revisions.
+func DiffStreams(from ActivityStream, to ActivityStream) (Patch, error) {
+	return DiffJSON(from.State, to.State)
+}
+
+/*
+DiffRevisions returns what changed in a stream's state between two of its
+revisions, see StreamRevisions.
+host:http://ip:port
+*/
+func DiffRevisions(ctx context.Context, host string, id string, fromRev string, toRev string) (Patch, error) {
+	from, _, err := GetStreamAt[json.RawMessage](ctx, host, id, fromRev)
+	if err != nil {
+		return nil, err
+	}
+	to, _, err := GetStreamAt[json.RawMessage](ctx, host, id, toRev)
+	if err != nil {
+		return nil, err
+	}
+	return DiffStreams(from, to)
+}
+
+func decodeNumbers(raw json.RawMessage) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	var v interface{}
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func diffValues(p *Patch, path string, a interface{}, b interface{}) error {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			return diffObjects(p, path, av, bv)
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			return diffArrays(p, path, av, bv)
+		}
+	}
+	if equalJSON(a, b) {
+		return nil
+	}
+	return p.add("replace", path, a, b)
+}
+
+func diffObjects(p *Patch, path string, a map[string]interface{}, b map[string]interface{}) error {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		av, inA := a[k]
+		bv, inB := b[k]
+		child := path + "/" + escapePointer(k)
+		var err error
+		switch {
+		case !inB:
+			err = p.add("remove", child, av, nil)
+		case !inA:
+			err = p.add("add", child, nil, bv)
+		default:
+			err = diffValues(p, child, av, bv)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffArrays compares elements by index. Surplus elements are removed from
+// the end first so every index stays valid while the patch is applied.
+func diffArrays(p *Patch, path string, a []interface{}, b []interface{}) error {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if err := diffValues(p, path+"/"+strconv.Itoa(i), a[i], b[i]); err != nil {
+			return err
+		}
+	}
+	for i := len(a) - 1; i >= n; i-- {
+		if err := p.add("remove", path+"/"+strconv.Itoa(i), a[i], nil); err != nil {
+			return err
+		}
+	}
+	for i := n; i < len(b); i++ {
+		if err := p.add("add", path+"/"+strconv.Itoa(i), nil, b[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Patch) add(op string, path string, old interface{}, value interface{}) error {
+	o := PatchOp{Op: op, Path: path}
+	var err error
+	if op != "add" {
+		if o.old, err = json.Marshal(old); err != nil {
+			return err
+		}
+	}
+	if op != "remove" {
+		if o.Value, err = json.Marshal(value); err != nil {
+			return err
+		}
+	}
+	*p = append(*p, o)
+	return nil
+}
+
+// equalJSON compares two decoded scalars.
+func equalJSON(a interface{}, b interface{}) bool {
+	an, aNum := a.(json.Number)
+	bn, bNum := b.(json.Number)
+	if aNum && bNum {
+		if an == bn {
+			return true
+		}
+		ca, okA := canonicalNumber(string(an))
+		cb, okB := canonicalNumber(string(bn))
+		return okA && okB && ca == cb
+	}
+	if aNum || bNum {
+		return false
+	}
+	switch a.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	switch b.(type) {
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	return a == b
+}
+
+// canonicalNumber rewrites a JSON number as its sign, significant digits
+// and exponent, so numbers of equal value compare equal exactly, however
+// large or precise, and however they are written.
+func canonicalNumber(n string) (string, bool) {
+	sign := ""
+	if strings.HasPrefix(n, "-") {
+		sign, n = "-", n[1:]
+	}
+	exp := 0
+	if i := strings.IndexAny(n, "eE"); i >= 0 {
+		e, err := strconv.Atoi(strings.TrimPrefix(n[i+1:], "+"))
+		if err != nil {
+			return "", false
+		}
+		exp, n = e, n[:i]
+	}
+	if i := strings.IndexByte(n, '.'); i >= 0 {
+		exp -= len(n) - i - 1
+		n = n[:i] + n[i+1:]
+	}
+
+	n = strings.TrimLeft(n, "0")
+	if n == "" {
+		return "0", true
+	}
+	digits := strings.TrimRight(n, "0")
+	exp += len(n) - len(digits)
+	return sign + digits + "e" + strconv.Itoa(exp), true
+}
+
+// escapePointer escapes a key for use in a JSON Pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,132 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "equal documents",
+			from: `{"a":1,"b":[true,null,"x"]}`,
+			to:   `{"b":[true,null,"x"],"a":1}`,
+			want: `null`,
+		},
+		{
+			name: "object members",
+			from: `{"keep":1,"gone":"x","change":{"n":1}}`,
+			to:   `{"keep":1,"change":{"n":2},"new":[1]}`,
+			want: `[{"op":"replace","path":"/change/n","value":2},{"op":"remove","path":"/gone"},{"op":"add","path":"/new","value":[1]}]`,
+		},
+		{
+			name: "shorter array removes from the end",
+			from: `{"a":[1,2,3,4]}`,
+			to:   `{"a":[1,5]}`,
+			want: `[{"op":"replace","path":"/a/1","value":5},{"op":"remove","path":"/a/3"},{"op":"remove","path":"/a/2"}]`,
+		},
+		{
+			name: "longer array",
+			from: `[1]`,
+			to:   `[1,{"b":2}]`,
+			want: `[{"op":"add","path":"/1","value":{"b":2}}]`,
+		},
+		{
+			name: "type change",
+			from: `{"a":{"b":1}}`,
+			to:   `{"a":[1]}`,
+			want: `[{"op":"replace","path":"/a","value":[1]}]`,
+		},
+		{
+			name: "root replaced",
+			from: `1`,
+			to:   `"1"`,
+			want: `[{"op":"replace","path":"","value":"1"}]`,
+		},
+		{
+			name: "pointer escaping",
+			from: `{"a/b":1,"m~n":1,"~1":1,"":1}`,
+			to:   `{"a/b":2,"m~n":2,"~1":2,"":2}`,
+			want: `[{"op":"replace","path":"/","value":2},{"op":"replace","path":"/a~1b","value":2},{"op":"replace","path":"/m~0n","value":2},{"op":"replace","path":"/~01","value":2}]`,
+		},
+		{
+			name: "numbers equal by value",
+			from: `[1,1.5,0,-100,12300]`,
+			to:   `[1.0,15e-1,-0.0,-1E2,1.23e+4]`,
+			want: `null`,
+		},
+		{
+			name: "big integers compared exactly",
+			from: `{"a":9007199254740993,"b":123456789012345678901234567890}`,
+			to:   `{"a":9007199254740992,"b":123456789012345678901234567891}`,
+			want: `[{"op":"replace","path":"/a","value":9007199254740992},{"op":"replace","path":"/b","value":123456789012345678901234567891}]`,
+		},
+		{
+			name: "precise decimals compared exactly",
+			from: `[0.1000000000000000000001]`,
+			to:   `[0.1]`,
+			want: `[{"op":"replace","path":"/0","value":0.1}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := DiffJSON(json.RawMessage(tt.from), json.RawMessage(tt.to))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := json.Marshal(p)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatchString(t *testing.T) {
+	p, err := DiffJSON(json.RawMessage(`{"a":1,"b/c":"x"}`), json.RawMessage(`{"a":2,"d":[true]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "changed /a: 1 -> 2\nremoved /b~1c (was \"x\")\nadded   /d = [true]\n"
+	if got := p.String(); got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	p, err = DiffJSON(json.RawMessage(`null`), json.RawMessage(`{}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, want := p.String(), "changed (root): null -> {}\n"; got != want {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
@@ -0,0 +1,139 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/pem"
+	"errors"
+)
+
+/*
+Generate a pair of Ed25519 private and public key.
+Output: Private key object.
+Public key can be extracted using
+publicKey:=key.Public().(ed25519.PublicKey)
+*/
+func Ed25519KeyGen() (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	ED25519Key = key
+	KeyType = Encrptype[ED25519]
+	return key, nil
+}
+
+/*
+Sign a transaction using your private key. Ed25519 hashes internally so the data is signed as is.
+Input: Private Key,Transaction byte array
+Output: base64 signature
+*/
+func Ed25519Sign(prv ed25519.PrivateKey, data []byte) string {
+	return b64.StdEncoding.EncodeToString(ed25519.Sign(prv, data))
+}
+
+/*
+Verify a signature made by Ed25519Sign.
+Input: Public Key, signed data, base64 signature
+Output: nil when the signature is valid
+*/
+func Ed25519Verify(pub ed25519.PublicKey, data []byte, sig string) error {
+	sigBytes, err := b64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(pub, data, sigBytes) {
+		return errors.New("ed25519: signature verification failed")
+	}
+	return nil
+}
+
+/*
+Convert Private key object into PKCS8 PEM Private & PKIX PEM Public
+Input: Private key
+Output: Pem formatted private and public key
+*/
+func Ed25519ToPem(prv ed25519.PrivateKey) (string, string, error) {
+	prvBytes, err := x509.MarshalPKCS8PrivateKey(prv)
+	if err != nil {
+		return "", "", err
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(prv.Public())
+	if err != nil {
+		return "", "", err
+	}
+
+	prvPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: prvBytes})
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+	return string(prvPem), string(pubPem), nil
+}
+
+/*
+Convert PEM to Private key object
+Input: Pem encoded private key(String)
+Output: Private key object
+*/
+func Ed25519FromPem(pemEncoded string) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("ed25519: no PEM block found")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	prv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("ed25519: PEM block is not an Ed25519 private key")
+	}
+	return prv, nil
+}
+
+/*
+Convert a PEM encoded public key back into a key object.
+Input: Pem encoded public key(String)
+Output: Public key object
+*/
+func Ed25519PublicFromPem(pemEncoded string) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("ed25519: no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("ed25519: PEM block is not an Ed25519 public key")
+	}
+	return pub, nil
+}
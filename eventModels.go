@@ -0,0 +1,159 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ActivityEvent is a change to an activity stream, as published on
+// /api/activity/subscribe and /api/activity/subscribe/{stream}.
+type ActivityEvent struct {
+	EventID  string
+	StreamID string
+	Revision string
+	UMID     string
+	// Stream is the stream document after the change.
+	Stream json.RawMessage
+}
+
+// ContractEvent is an event emitted by a contract, as published on
+// /api/events, /api/events/{contract} and /api/events/{contract}/{event}.
+type ContractEvent struct {
+	EventID  string
+	Contract string
+	Name     string
+	UMID     string
+	Payload  json.RawMessage
+}
+
+// ErrEmptyEvent is returned when an event carries no JSON object.
+var ErrEmptyEvent = errors.New("event has no JSON payload")
+
+// eventBody reads the JSON object an event carries, unwrapping the "event"
+// envelope nodes put around it.
+func eventBody(ev Event) (map[string]json.RawMessage, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(ev.Raw), &body); err != nil || body == nil {
+		return nil, ErrEmptyEvent
+	}
+	if inner, ok := body["event"]; ok && strings.HasPrefix(string(inner), "{") {
+		var unwrapped map[string]json.RawMessage
+		if err := json.Unmarshal(inner, &unwrapped); err == nil {
+			return unwrapped, nil
+		}
+	}
+	return body, nil
+}
+
+// stringField returns the first of keys holding a JSON string.
+func stringField(body map[string]json.RawMessage, keys ...string) string {
+	for _, key := range keys {
+		var s string
+		if raw, ok := body[key]; ok && json.Unmarshal(raw, &s) == nil && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// ParseActivityEvent reads a stream change from an activity event. The node
+// either sends the stream document itself or a change record holding it in doc.
+func ParseActivityEvent(ev Event) (ActivityEvent, error) {
+	body, err := eventBody(ev)
+	if err != nil {
+		return ActivityEvent{}, fmt.Errorf("activity event %q: %w", ev.ID, err)
+	}
+
+	doc := body
+	if raw, ok := body["doc"]; ok {
+		// a fresh map, so the change record's fields stay out of the document
+		var inner map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &inner); err != nil {
+			return ActivityEvent{}, fmt.Errorf("activity event %q: %w", ev.ID, err)
+		}
+		doc = inner
+	}
+
+	a := ActivityEvent{
+		EventID:  ev.ID,
+		StreamID: stringField(doc, "_id", "id"),
+		Revision: stringField(doc, "_rev", "rev"),
+		UMID:     stringField(doc, "$umid", "umid"),
+	}
+	if a.StreamID == "" {
+		a.StreamID = stringField(body, "id", "_id")
+	}
+	if a.Revision == "" {
+		var changes []struct {
+			Rev string `json:"rev"`
+		}
+		if json.Unmarshal(body["changes"], &changes) == nil && len(changes) > 0 {
+			a.Revision = changes[0].Rev
+		}
+	}
+	if a.StreamID == "" {
+		return ActivityEvent{}, fmt.Errorf("activity event %q: no stream id", ev.ID)
+	}
+
+	a.Stream, err = json.Marshal(doc)
+	if err != nil {
+		return ActivityEvent{}, err
+	}
+	return a, nil
+}
+
+// ParseContractEvent reads a contract event.
+func ParseContractEvent(ev Event) (ContractEvent, error) {
+	body, err := eventBody(ev)
+	if err != nil {
+		return ContractEvent{}, fmt.Errorf("contract event %q: %w", ev.ID, err)
+	}
+
+	c := ContractEvent{
+		EventID:  ev.ID,
+		Contract: stringField(body, "contract"),
+		Name:     stringField(body, "name", "event"),
+		UMID:     stringField(body, "$umid", "umid"),
+		Payload:  body["data"],
+	}
+	if c.Name == "" && ev.Name != "message" {
+		c.Name = ev.Name
+	}
+	return c, nil
+}
+
+// Decode unmarshals a contract event's payload into T.
+func Decode[T any](ev ContractEvent) (T, error) {
+	var v T
+	if len(ev.Payload) == 0 {
+		return v, fmt.Errorf("contract event %s/%s: %w", ev.Contract, ev.Name, ErrEmptyEvent)
+	}
+	if err := json.Unmarshal(ev.Payload, &v); err != nil {
+		return v, fmt.Errorf("contract event %s/%s: %w", ev.Contract, ev.Name, err)
+	}
+	return v, nil
+}
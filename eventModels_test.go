@@ -0,0 +1,87 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseActivityEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		raw    string
+		want   ActivityEvent
+		stream string
+	}{
+		{
+			name:   "stream document",
+			raw:    `{"_id":"s1","_rev":"2-b","$umid":"u1","state":1}`,
+			want:   ActivityEvent{StreamID: "s1", Revision: "2-b", UMID: "u1"},
+			stream: `{"$umid":"u1","_id":"s1","_rev":"2-b","state":1}`,
+		},
+		{
+			name:   "change record",
+			raw:    `{"id":"outer","seq":"9-x","changes":[{"rev":"3-c"}],"doc":{"_id":"s1","_rev":"3-c","state":1}}`,
+			want:   ActivityEvent{StreamID: "s1", Revision: "3-c"},
+			stream: `{"_id":"s1","_rev":"3-c","state":1}`,
+		},
+		{
+			name:   "change record without revision in doc",
+			raw:    `{"id":"s2","seq":"9-x","changes":[{"rev":"4-d"}],"doc":{"state":2}}`,
+			want:   ActivityEvent{StreamID: "s2", Revision: "4-d"},
+			stream: `{"state":2}`,
+		},
+		{
+			name:   "wrapped in event",
+			raw:    `{"event":{"id":"s3","changes":[{"rev":"1-a"}],"doc":{"_id":"s3","_rev":"1-a"}}}`,
+			want:   ActivityEvent{StreamID: "s3", Revision: "1-a"},
+			stream: `{"_id":"s3","_rev":"1-a"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParseActivityEvent(Event{ID: "e1", Raw: tt.raw})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			stream := a.Stream
+			a.Stream, tt.want.EventID = nil, "e1"
+			if a.EventID != tt.want.EventID || a.StreamID != tt.want.StreamID || a.Revision != tt.want.Revision || a.UMID != tt.want.UMID {
+				t.Errorf("got %+v, want %+v", a, tt.want)
+			}
+			// re-marshalled so keys are sorted
+			var doc interface{}
+			if err := json.Unmarshal(stream, &doc); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got, _ := json.Marshal(doc); string(got) != tt.stream {
+				t.Errorf("Stream = %s, want %s", got, tt.stream)
+			}
+		})
+	}
+
+	if _, err := ParseActivityEvent(Event{ID: "e2", Raw: `{"seq":"1"}`}); err == nil {
+		t.Error("an event without a stream id should be an error")
+	}
+}
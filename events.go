@@ -24,70 +24,72 @@
 package sdk
 
 import (
-	"log"
 	"net/url"
-
-	"github.com/peterhellberg/sseclient"
 )
 
-func Subscribe(host string) (chan sseclient.Event, error) {
-	u, err := url.Parse(host)
-	if err != nil {
-		log.Fatal(err)
-	}
-	rel, err := u.Parse("/api/activity/subscribe")
-	if err != nil {
-		log.Fatal(err)
-	}
-	events, err := sseclient.OpenURL(rel.String())
+// Subscribe opens a stream of changes to every activity stream.
+// host:http://ip:port
+func Subscribe(host string) (*EventStream, error) {
+	return openTopic(host, ActivityTopic())
+}
 
-	return events, err
+// SubscribeStream opens a stream of changes to a single activity stream.
+func SubscribeStream(host string, stream string) (*EventStream, error) {
+	return openTopic(host, StreamTopic(stream))
 }
-func SubscribeStream(host string, stream string) (chan sseclient.Event, error) {
-	u, err := url.Parse(host)
-	if err != nil {
-		log.Fatal(err)
-	}
-	rel, err := u.Parse("/api/activity/subscribe/" + stream)
-	if err != nil {
-		log.Fatal(err)
-	}
-	events, err := sseclient.OpenURL(rel.String())
-	return events, err
+
+// EventSubscribeContract opens a stream of one named event from a contract.
+func EventSubscribeContract(host string, contract string, event string) (*EventStream, error) {
+	return openTopic(host, ContractEventTopic(contract, event))
 }
-func EventSubscribeContract(host string, contract string, event string) (chan sseclient.Event, error) {
-	u, err := url.Parse(host)
-	if err != nil {
-		log.Fatal(err)
-	}
-	rel, err := u.Parse("/api/events/" + contract + "/" + event)
-	if err != nil {
-		log.Fatal(err)
-	}
-	events, err := sseclient.OpenURL(rel.String())
-	return events, err
+
+// EventSubscribe opens a stream of every event from a contract.
+func EventSubscribe(host string, contract string) (*EventStream, error) {
+	return openTopic(host, ContractTopic(contract))
 }
-func EventSubscribe(host string, contract string) (chan sseclient.Event, error) {
-	u, err := url.Parse(host)
-	if err != nil {
-		log.Fatal(err)
-	}
-	rel, err := u.Parse("/api/events/" + contract)
+
+// AllEventSubscribe opens a stream of every contract event.
+func AllEventSubscribe(host string) (*EventStream, error) {
+	return openTopic(host, AllEventsTopic())
+}
+
+func openTopic(host string, topic Topic) (*EventStream, error) {
+	rawurl, err := topic.URL(host)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	events, err := sseclient.OpenURL(rel.String())
-	return events, err
+	return OpenEventStream(rawurl)
 }
-func AllEventSubscribe(host string) (chan sseclient.Event, error) {
+
+// Topic is the path of an event endpoint, relative to the node serving it.
+type Topic string
+
+// ActivityTopic carries changes to every activity stream.
+func ActivityTopic() Topic { return "/api/activity/subscribe" }
+
+// StreamTopic carries changes to a single activity stream.
+func StreamTopic(stream string) Topic { return Topic("/api/activity/subscribe/" + stream) }
+
+// ContractEventTopic carries one named event emitted by a contract.
+func ContractEventTopic(contract string, event string) Topic {
+	return Topic("/api/events/" + contract + "/" + event)
+}
+
+// ContractTopic carries every event emitted by a contract.
+func ContractTopic(contract string) Topic { return Topic("/api/events/" + contract) }
+
+// AllEventsTopic carries every contract event.
+func AllEventsTopic() Topic { return "/api/events/" }
+
+// URL resolves the topic against a node, host:http://ip:port
+func (t Topic) URL(host string) (string, error) {
 	u, err := url.Parse(host)
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	rel, err := u.Parse("/api/events/")
+	rel, err := u.Parse(string(t))
 	if err != nil {
-		log.Fatal(err)
+		return "", err
 	}
-	events, err := sseclient.OpenURL(rel.String())
-	return events, err
+	return rel.String(), nil
 }
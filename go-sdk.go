@@ -23,6 +23,8 @@
 package sdk
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"fmt"
 	"os"
@@ -38,6 +40,12 @@ var (
 	KeyType string
 )
 
+// Keys created by Ed25519KeyGen and P256KeyGen
+var (
+	ED25519Key ed25519.PrivateKey
+	P256Key    *ecdsa.PrivateKey
+)
+
 //Utility function to check and print error if any.
 func checkError(err error) {
 	if err != nil {
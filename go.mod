@@ -1,8 +1,5 @@
 module github.com/activeledger/SDK-Golang
 
-go 1.15
+go 1.18
 
-require (
-	github.com/peterhellberg/sseclient v0.0.0-20190910165922-d1094337c01e
-	github.com/titanous/bitcoin-crypto v0.0.0-20121127183713-5eeb3a67e50a
-)
+require github.com/titanous/bitcoin-crypto v0.0.0-20121127183713-5eeb3a67e50a
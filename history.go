@@ -0,0 +1,319 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrRevisionNotFound is returned when a node cannot supply a stream at the
+// requested revision or time.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is one committed revision of a stream.
+type Revision struct {
+	StreamID string
+	Revision string
+	// UMID identifies the transaction that wrote the revision, empty when
+	// the node did not report it.
+	UMID string
+	// Committed is when that transaction was processed, zero when unknown.
+	Committed time.Time
+}
+
+// Generation is the numeric prefix of the revision, see StreamChange.
+func (r Revision) Generation() int {
+	return revGeneration(r.Revision)
+}
+
+// historyCacheSize bounds the revisions and transactions kept in memory.
+const historyCacheSize = 4096
+
+// Past revisions and committed transactions never change, so they are
+// cached once fetched.
+var (
+	revisionCache = newImmutableCache[json.RawMessage](historyCacheSize)
+	txCache       = newImmutableCache[*TransactionRecord](historyCacheSize)
+)
+
+/*
+StreamRevisions lists the revisions of a stream, oldest first, with the
+transaction that wrote each. The revision history is read from the stream
+itself, as revs_info or revs, and each past revision is fetched like
+GetStreamAt to find its UMID. Revisions the node has compacted away are
+listed without a UMID. A node which reports no history gives only the
+current revision; the changes feed cannot stand in, as it holds just the
+latest revision of each stream.
+host:http://ip:port
+*/
+func StreamRevisions(ctx context.Context, host string, id string) ([]Revision, error) {
+	history, err := streamHistory(ctx, host, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// history is newest first
+	revs := make([]Revision, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		r := Revision{StreamID: id, Revision: history[i].rev}
+		if history[i].available {
+			doc, err := streamRevision(ctx, host, id, r.Revision)
+			if err != nil && !errors.Is(err, ErrRevisionNotFound) {
+				return nil, err
+			}
+			if err == nil {
+				r.UMID = stringField(doc, "$umid", "umid")
+			}
+		}
+		if r.UMID != "" {
+			if r.Committed, err = transactionTime(ctx, host, r.UMID); err != nil {
+				return nil, err
+			}
+		}
+		revs = append(revs, r)
+	}
+	return revs, nil
+}
+
+type pastRevision struct {
+	rev string
+	// available is false when the node reports the revision's body gone
+	available bool
+}
+
+// streamHistory returns the revisions of a stream newest first, or just the
+// current one when the node reports no history. The current revision is
+// cached on the way.
+func streamHistory(ctx context.Context, host string, id string) ([]pastRevision, error) {
+	var body map[string]json.RawMessage
+	q := url.Values{"revs_info": {"true"}, "revs": {"true"}}
+	if err := getJSON(ctx, http.DefaultClient, host, "/api/stream/"+url.PathEscape(id), q, &body); err != nil {
+		return nil, err
+	}
+	doc, err := unwrapStream(body)
+	if err != nil {
+		return nil, err
+	}
+	history, err := revisionHistory(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	current := stringField(doc, "_rev")
+	if current != "" {
+		delete(doc, "_revs_info")
+		delete(doc, "_revisions")
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		revisionCache.Put(id+"@"+current, raw)
+	}
+	if len(history) == 0 && current != "" {
+		history = []pastRevision{{rev: current, available: true}}
+	}
+	return history, nil
+}
+
+// revisionHistory reads the revisions listed in a stream fetched with
+// revs_info or revs, newest first.
+func revisionHistory(doc map[string]json.RawMessage) ([]pastRevision, error) {
+	if raw, ok := doc["_revs_info"]; ok {
+		var infos []struct {
+			Rev    string `json:"rev"`
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(raw, &infos); err != nil {
+			return nil, err
+		}
+		history := make([]pastRevision, 0, len(infos))
+		for _, info := range infos {
+			if info.Rev != "" {
+				history = append(history, pastRevision{rev: info.Rev, available: info.Status == "available"})
+			}
+		}
+		return history, nil
+	}
+
+	if raw, ok := doc["_revisions"]; ok {
+		var revisions struct {
+			Start int      `json:"start"`
+			IDs   []string `json:"ids"`
+		}
+		if err := json.Unmarshal(raw, &revisions); err != nil {
+			return nil, err
+		}
+		history := make([]pastRevision, 0, len(revisions.IDs))
+		for i, hash := range revisions.IDs {
+			history = append(history, pastRevision{rev: strconv.Itoa(revisions.Start-i) + "-" + hash, available: true})
+		}
+		return history, nil
+	}
+	return nil, nil
+}
+
+// GetStreamAt fetches a stream as it was at revision rev and decodes its
+// state into T.
+func GetStreamAt[T any](ctx context.Context, host string, id string, rev string) (ActivityStream, T, error) {
+	var zero T
+	doc, err := streamRevision(ctx, host, id, rev)
+	if err != nil {
+		return ActivityStream{}, zero, err
+	}
+	s, err := ParseActivityStream(doc)
+	if err != nil {
+		return ActivityStream{}, zero, err
+	}
+	v, err := DecodeState[T](s)
+	return s, v, err
+}
+
+// GetStreamAtTime fetches a stream as it was at time at: the last revision
+// whose transaction was committed at or before it.
+func GetStreamAtTime[T any](ctx context.Context, host string, id string, at time.Time) (ActivityStream, T, error) {
+	var zero T
+	revs, err := StreamRevisions(ctx, host, id)
+	if err != nil {
+		return ActivityStream{}, zero, err
+	}
+
+	rev := ""
+	for _, r := range revs {
+		if !r.Committed.IsZero() && !r.Committed.After(at) {
+			rev = r.Revision
+		}
+	}
+	if rev == "" {
+		return ActivityStream{}, zero, fmt.Errorf("stream %s at %s: %w", id, at.Format(time.RFC3339), ErrRevisionNotFound)
+	}
+	return GetStreamAt[T](ctx, host, id, rev)
+}
+
+// streamRevision returns the stream document at rev, from the cache or
+// else by asking the node for that revision.
+func streamRevision(ctx context.Context, host string, id string, rev string) (map[string]json.RawMessage, error) {
+	key := id + "@" + rev
+	if raw, ok := revisionCache.Get(key); ok {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+
+	var body map[string]json.RawMessage
+	err := getJSON(ctx, http.DefaultClient, host, "/api/stream/"+url.PathEscape(id), url.Values{"rev": {rev}}, &body)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("stream %s revision %s: %w", id, rev, ErrRevisionNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	doc, err := unwrapStream(body)
+	if err != nil {
+		return nil, err
+	}
+	// nodes that cannot serve old revisions answer with the current one
+	if stringField(doc, "_rev") != rev {
+		return nil, fmt.Errorf("stream %s revision %s: %w", id, rev, ErrRevisionNotFound)
+	}
+
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	revisionCache.Put(key, raw)
+	return doc, nil
+}
+
+// transactionTime returns when the transaction umid was processed, or the
+// zero time when its record does not say or the node has no record of it.
+func transactionTime(ctx context.Context, host string, umid string) (time.Time, error) {
+	record, err := fetchTransaction(ctx, host, umid)
+	if errors.Is(err, ErrTransactionNotFound) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return record.Datetime, nil
+}
+
+// ledgerTime reads a time sent as an RFC 3339 string or as milliseconds
+// since the epoch. It returns the zero time for anything else.
+func ledgerTime(raw json.RawMessage) time.Time {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return t
+		}
+		raw = json.RawMessage(s)
+	}
+	if ms, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+		return time.UnixMilli(ms)
+	}
+	return time.Time{}
+}
+
+// immutableCache holds values which never change once written, dropping
+// the oldest entries beyond its size.
+type immutableCache[V any] struct {
+	mu     sync.Mutex
+	values map[string]V
+	ring   []string
+	next   int
+}
+
+func newImmutableCache[V any](size int) *immutableCache[V] {
+	return &immutableCache[V]{values: make(map[string]V, size), ring: make([]string, size)}
+}
+
+func (c *immutableCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	return v, ok
+}
+
+func (c *immutableCache[V]) Put(key string, v V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.values[key]; ok {
+		return
+	}
+	if old := c.ring[c.next]; old != "" {
+		delete(c.values, old)
+	}
+	c.ring[c.next] = key
+	c.next = (c.next + 1) % len(c.ring)
+	c.values[key] = v
+}
@@ -0,0 +1,108 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	b64 "encoding/base64"
+	"math/big"
+
+	"github.com/titanous/bitcoin-crypto/bitecdsa"
+)
+
+// JWK is a JSON Web Key (RFC 7517). D is only set for private keys.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	D   string `json:"d,omitempty"`
+}
+
+/*
+Convert a public key object into a JWK.
+Supports RSA, secp256k1, Ed25519 and P-256 keys.
+*/
+func PublicKeyToJWK(key crypto.PublicKey) (JWK, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   jwkEncode(k.N.Bytes()),
+			E:   jwkEncode(big.NewInt(int64(k.E)).Bytes()),
+		}, nil
+	case *bitecdsa.PublicKey:
+		size := (k.BitSize + 7) / 8
+		return JWK{Kty: "EC", Crv: "secp256k1", X: jwkInt(k.X, size), Y: jwkInt(k.Y, size)}, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return JWK{}, keyTypeError("jwk", key)
+		}
+		return JWK{Kty: "EC", Crv: "P-256", X: jwkInt(k.X, 32), Y: jwkInt(k.Y, 32)}, nil
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: jwkEncode(k)}, nil
+	}
+	return JWK{}, keyTypeError("jwk", key)
+}
+
+/*
+Convert a private key object into a JWK, including the private part.
+Supports RSA, secp256k1, Ed25519 and P-256 keys.
+*/
+func PrivateKeyToJWK(key crypto.PrivateKey) (JWK, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		jwk, err := PublicKeyToJWK(&k.PublicKey)
+		jwk.D = jwkEncode(k.D.Bytes())
+		return jwk, err
+	case *bitecdsa.PrivateKey:
+		jwk, err := PublicKeyToJWK(&k.PublicKey)
+		jwk.D = jwkInt(k.D, (k.BitSize+7)/8)
+		return jwk, err
+	case *ecdsa.PrivateKey:
+		jwk, err := PublicKeyToJWK(&k.PublicKey)
+		jwk.D = jwkInt(k.D, 32)
+		return jwk, err
+	case ed25519.PrivateKey:
+		jwk, err := PublicKeyToJWK(k.Public())
+		jwk.D = jwkEncode(k.Seed())
+		return jwk, err
+	}
+	return JWK{}, keyTypeError("jwk", key)
+}
+
+func jwkEncode(b []byte) string {
+	return b64.RawURLEncoding.EncodeToString(b)
+}
+
+// jwkInt encodes a curve coordinate left padded to the curve size, as RFC 7518 requires.
+func jwkInt(i *big.Int, size int) string {
+	b := make([]byte, size)
+	return jwkEncode(i.FillBytes(b))
+}
@@ -0,0 +1,238 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	b64 "encoding/base64"
+	"fmt"
+
+	"github.com/titanous/bitcoin-crypto/bitecdsa"
+)
+
+// KeyAlgorithm signs and verifies transactions for one Encryption type.
+// Signatures are exchanged as the base64 strings Activeledger expects in $sigs.
+type KeyAlgorithm interface {
+	Sign(key crypto.PrivateKey, data []byte) (string, error)
+	Verify(key crypto.PublicKey, data []byte, sig string) error
+	// PublicPem returns the public key to onboard for the private key.
+	PublicPem(key crypto.PrivateKey) (string, error)
+	ParsePublicPem(pemEncoded string) (crypto.PublicKey, error)
+}
+
+// keyAlgorithms is indexed by Encryption and kept in step with Encrptype.
+var keyAlgorithms = []KeyAlgorithm{
+	rsaAlgorithm{},
+	secp256k1Algorithm{},
+	ed25519Algorithm{},
+	p256Algorithm{},
+}
+
+// RegisterEncryption adds a key type under the name the ledger knows it by and
+// returns its Encryption value. Call it from an init function, before keys are used.
+func RegisterEncryption(name string, alg KeyAlgorithm) Encryption {
+	if _, ok := EncryptionByName(name); ok {
+		panic("sdk: encryption " + name + " already registered")
+	}
+	Encrptype = append(Encrptype, name)
+	keyAlgorithms = append(keyAlgorithms, alg)
+	return Encryption(len(Encrptype) - 1)
+}
+
+// EncryptionByName looks up a key type by its ledger name, eg "rsa".
+func EncryptionByName(name string) (Encryption, bool) {
+	for i, n := range Encrptype {
+		if n == name {
+			return Encryption(i), true
+		}
+	}
+	return 0, false
+}
+
+// Algorithm returns the signer and verifier registered for the key type.
+func (encrp Encryption) Algorithm() (KeyAlgorithm, error) {
+	if encrp < 0 || int(encrp) >= len(keyAlgorithms) {
+		return nil, fmt.Errorf("sdk: unknown encryption %d", int(encrp))
+	}
+	return keyAlgorithms[encrp], nil
+}
+
+// VerifyPem checks a signature against a PEM public key of the named type, as
+// stored on an identity stream by the onboard contract.
+func VerifyPem(keyType string, publicPem string, data []byte, sig string) error {
+	encrp, ok := EncryptionByName(keyType)
+	if !ok {
+		return fmt.Errorf("sdk: unknown key type %q", keyType)
+	}
+	alg, err := encrp.Algorithm()
+	if err != nil {
+		return err
+	}
+	pub, err := alg.ParsePublicPem(publicPem)
+	if err != nil {
+		return err
+	}
+	return alg.Verify(pub, data, sig)
+}
+
+func keyTypeError(alg string, key interface{}) error {
+	return fmt.Errorf("%s: missing or unsupported key %T", alg, key)
+}
+
+type rsaAlgorithm struct{}
+
+func (rsaAlgorithm) Sign(key crypto.PrivateKey, data []byte) (string, error) {
+	var prv *rsa.PrivateKey
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		prv = k
+	case rsa.PrivateKey:
+		prv = &k
+	}
+	if prv == nil {
+		return "", keyTypeError("rsa", key)
+	}
+	sign, err := RsaSign(*prv, data)
+	if err != nil {
+		return "", err
+	}
+	return b64.StdEncoding.EncodeToString(sign), nil
+}
+
+func (rsaAlgorithm) Verify(key crypto.PublicKey, data []byte, sig string) error {
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return keyTypeError("rsa", key)
+	}
+	return RsaVerify(pub, data, sig)
+}
+
+func (rsaAlgorithm) PublicPem(key crypto.PrivateKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return RsaToPem(k.PublicKey), nil
+	case rsa.PrivateKey:
+		return RsaToPem(k.PublicKey), nil
+	}
+	return "", keyTypeError("rsa", key)
+}
+
+func (rsaAlgorithm) ParsePublicPem(pemEncoded string) (crypto.PublicKey, error) {
+	return RsaPublicFromPem(pemEncoded)
+}
+
+type secp256k1Algorithm struct{}
+
+func (secp256k1Algorithm) Sign(key crypto.PrivateKey, data []byte) (string, error) {
+	prv, ok := key.(*bitecdsa.PrivateKey)
+	if !ok || prv == nil {
+		return "", keyTypeError("secp256k1", key)
+	}
+	return EcdsaSign(prv, string(data)), nil
+}
+
+func (secp256k1Algorithm) Verify(key crypto.PublicKey, data []byte, sig string) error {
+	pub, ok := key.(*bitecdsa.PublicKey)
+	if !ok {
+		return keyTypeError("secp256k1", key)
+	}
+	return EcdsaVerify(pub, data, sig)
+}
+
+func (secp256k1Algorithm) PublicPem(key crypto.PrivateKey) (string, error) {
+	prv, ok := key.(*bitecdsa.PrivateKey)
+	if !ok {
+		return "", keyTypeError("secp256k1", key)
+	}
+	_, pub := EcdsaToPem(prv)
+	return pub, nil
+}
+
+func (secp256k1Algorithm) ParsePublicPem(pemEncoded string) (crypto.PublicKey, error) {
+	return EcdsaPublicFromPem(pemEncoded)
+}
+
+type ed25519Algorithm struct{}
+
+func (ed25519Algorithm) Sign(key crypto.PrivateKey, data []byte) (string, error) {
+	prv, ok := key.(ed25519.PrivateKey)
+	if !ok || len(prv) != ed25519.PrivateKeySize {
+		return "", keyTypeError("ed25519", key)
+	}
+	return Ed25519Sign(prv, data), nil
+}
+
+func (ed25519Algorithm) Verify(key crypto.PublicKey, data []byte, sig string) error {
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return keyTypeError("ed25519", key)
+	}
+	return Ed25519Verify(pub, data, sig)
+}
+
+func (ed25519Algorithm) PublicPem(key crypto.PrivateKey) (string, error) {
+	prv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", keyTypeError("ed25519", key)
+	}
+	_, pub, err := Ed25519ToPem(prv)
+	return pub, err
+}
+
+func (ed25519Algorithm) ParsePublicPem(pemEncoded string) (crypto.PublicKey, error) {
+	return Ed25519PublicFromPem(pemEncoded)
+}
+
+type p256Algorithm struct{}
+
+func (p256Algorithm) Sign(key crypto.PrivateKey, data []byte) (string, error) {
+	prv, ok := key.(*ecdsa.PrivateKey)
+	if !ok || prv == nil {
+		return "", keyTypeError("secp256r1", key)
+	}
+	return P256Sign(prv, data)
+}
+
+func (p256Algorithm) Verify(key crypto.PublicKey, data []byte, sig string) error {
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return keyTypeError("secp256r1", key)
+	}
+	return P256Verify(pub, data, sig)
+}
+
+func (p256Algorithm) PublicPem(key crypto.PrivateKey) (string, error) {
+	prv, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return "", keyTypeError("secp256r1", key)
+	}
+	_, pub, err := P256ToPem(prv)
+	return pub, err
+}
+
+func (p256Algorithm) ParsePublicPem(pemEncoded string) (crypto.PublicKey, error) {
+	return P256PublicFromPem(pemEncoded)
+}
@@ -0,0 +1,247 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+
+	"github.com/titanous/bitcoin-crypto/bitecdsa"
+)
+
+func TestSignVerifyPem(t *testing.T) {
+	keys := testKeys(t)
+	others := testKeys(t)
+	data := []byte(`{"$namespace":"default","$contract":"onboard"}`)
+
+	for _, encrp := range []Encryption{RSA, EC, ED25519, P256} {
+		key := keys[encrp.String()]
+		t.Run(encrp.String(), func(t *testing.T) {
+			alg, err := encrp.Algorithm()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig, err := alg.Sign(key, data)
+			if err != nil {
+				t.Fatalf("Sign: %v", err)
+			}
+			pub, err := alg.PublicPem(key)
+			if err != nil {
+				t.Fatalf("PublicPem: %v", err)
+			}
+			if err := VerifyPem(encrp.String(), pub, data, sig); err != nil {
+				t.Errorf("VerifyPem: %v", err)
+			}
+
+			if err := VerifyPem(encrp.String(), pub, []byte(`{"$namespace":"other"}`), sig); err == nil {
+				t.Error("VerifyPem accepted the signature for altered data")
+			}
+			otherPub, err := alg.PublicPem(others[encrp.String()])
+			if err != nil {
+				t.Fatalf("PublicPem: %v", err)
+			}
+			if err := VerifyPem(encrp.String(), otherPub, data, sig); err == nil {
+				t.Error("VerifyPem accepted the signature under another key")
+			}
+			wrong := keys[((encrp + 1) % (P256 + 1)).String()]
+			if _, err := alg.Sign(wrong, data); err == nil {
+				t.Errorf("Sign accepted a %T", wrong)
+			}
+		})
+	}
+
+	if err := VerifyPem("unknown", "", data, ""); err == nil {
+		t.Error("VerifyPem accepted an unknown key type")
+	}
+}
+
+func TestPemRoundTrip(t *testing.T) {
+	keys := testKeys(t)
+
+	t.Run("ed25519", func(t *testing.T) {
+		key := keys["ed25519"].(ed25519.PrivateKey)
+		prvPem, pubPem, err := Ed25519ToPem(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prv, err := Ed25519FromPem(prvPem)
+		if err != nil || !prv.Equal(key) {
+			t.Errorf("Ed25519FromPem = %x, %v", prv, err)
+		}
+		pub, err := Ed25519PublicFromPem(pubPem)
+		if err != nil || !pub.Equal(key.Public()) {
+			t.Errorf("Ed25519PublicFromPem = %x, %v", pub, err)
+		}
+	})
+
+	t.Run("secp256r1", func(t *testing.T) {
+		key := keys["secp256r1"].(*ecdsa.PrivateKey)
+		prvPem, pubPem, err := P256ToPem(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prv, err := P256FromPem(prvPem)
+		if err != nil || !prv.Equal(key) {
+			t.Errorf("P256FromPem = %v, %v", prv, err)
+		}
+		pub, err := P256PublicFromPem(pubPem)
+		if err != nil || !pub.Equal(&key.PublicKey) {
+			t.Errorf("P256PublicFromPem = %v, %v", pub, err)
+		}
+	})
+
+	t.Run("rsa", func(t *testing.T) {
+		key := keys["rsa"].(*rsa.PrivateKey)
+		block, _ := pem.Decode([]byte(RsaPrivToPem(*key)))
+		if block == nil {
+			t.Fatal("RsaPrivToPem: no PEM block")
+		}
+		prv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil || !prv.Equal(key) {
+			t.Errorf("RsaPrivToPem round trip = %v, %v", prv, err)
+		}
+		pub, err := RsaPublicFromPem(RsaToPem(key.PublicKey))
+		if err != nil || !pub.Equal(&key.PublicKey) {
+			t.Errorf("RsaPublicFromPem = %v, %v", pub, err)
+		}
+	})
+
+	t.Run("secp256k1", func(t *testing.T) {
+		key := keys["secp256k1"].(*bitecdsa.PrivateKey)
+		prvPem, pubPem := EcdsaToPem(key)
+		prv := EcdsaFromPem(prvPem)
+		if prv.D.Cmp(key.D) != 0 || prv.X.Cmp(key.X) != 0 || prv.Y.Cmp(key.Y) != 0 {
+			t.Errorf("EcdsaFromPem = %+v, want %+v", prv, key)
+		}
+		pub, err := EcdsaPublicFromPem(pubPem)
+		if err != nil || pub.X.Cmp(key.X) != 0 || pub.Y.Cmp(key.Y) != 0 {
+			t.Errorf("EcdsaPublicFromPem = %+v, %v", pub, err)
+		}
+	})
+}
+
+func TestJWKRoundTrip(t *testing.T) {
+	keys := testKeys(t)
+
+	// raw reads a JWK field back, requiring size bytes when not zero
+	raw := func(t *testing.T, field string, size int) []byte {
+		t.Helper()
+		b, err := b64.RawURLEncoding.DecodeString(field)
+		if err != nil {
+			t.Fatalf("field %q: %v", field, err)
+		}
+		if size > 0 && len(b) != size {
+			t.Errorf("field %q is %d bytes, want %d", field, len(b), size)
+		}
+		return b
+	}
+	decode := func(t *testing.T, field string, size int) *big.Int {
+		t.Helper()
+		return new(big.Int).SetBytes(raw(t, field, size))
+	}
+
+	tests := []struct {
+		encrp    Encryption
+		kty, crv string
+		// check compares the decoded JWK with the key
+		check func(t *testing.T, jwk JWK, key crypto.PrivateKey)
+	}{
+		{RSA, "RSA", "", func(t *testing.T, jwk JWK, key crypto.PrivateKey) {
+			k := key.(*rsa.PrivateKey)
+			if decode(t, jwk.N, 0).Cmp(k.N) != 0 || decode(t, jwk.E, 0).Int64() != int64(k.E) {
+				t.Error("modulus or exponent differs")
+			}
+			if jwk.D != "" && decode(t, jwk.D, 0).Cmp(k.D) != 0 {
+				t.Error("private exponent differs")
+			}
+		}},
+		{EC, "EC", "secp256k1", func(t *testing.T, jwk JWK, key crypto.PrivateKey) {
+			k := key.(*bitecdsa.PrivateKey)
+			if decode(t, jwk.X, 32).Cmp(k.X) != 0 || decode(t, jwk.Y, 32).Cmp(k.Y) != 0 {
+				t.Error("public point differs")
+			}
+			if jwk.D != "" && decode(t, jwk.D, 32).Cmp(k.D) != 0 {
+				t.Error("private scalar differs")
+			}
+		}},
+		{ED25519, "OKP", "Ed25519", func(t *testing.T, jwk JWK, key crypto.PrivateKey) {
+			k := key.(ed25519.PrivateKey)
+			if !ed25519.PublicKey(raw(t, jwk.X, ed25519.PublicKeySize)).Equal(k.Public()) {
+				t.Error("public key differs")
+			}
+			if jwk.D != "" && !ed25519.NewKeyFromSeed(raw(t, jwk.D, ed25519.SeedSize)).Equal(k) {
+				t.Error("seed differs")
+			}
+		}},
+		{P256, "EC", "P-256", func(t *testing.T, jwk JWK, key crypto.PrivateKey) {
+			k := key.(*ecdsa.PrivateKey)
+			if decode(t, jwk.X, 32).Cmp(k.X) != 0 || decode(t, jwk.Y, 32).Cmp(k.Y) != 0 {
+				t.Error("public point differs")
+			}
+			if jwk.D != "" && decode(t, jwk.D, 32).Cmp(k.D) != 0 {
+				t.Error("private scalar differs")
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encrp.String(), func(t *testing.T) {
+			key := keys[tt.encrp.String()]
+			signer, ok := key.(crypto.Signer)
+			var pub crypto.PublicKey
+			if ok {
+				pub = signer.Public()
+			} else {
+				pub = &key.(*bitecdsa.PrivateKey).PublicKey
+			}
+
+			jwk, err := PublicKeyToJWK(pub)
+			if err != nil {
+				t.Fatalf("PublicKeyToJWK: %v", err)
+			}
+			if jwk.Kty != tt.kty || jwk.Crv != tt.crv || jwk.D != "" {
+				t.Errorf("PublicKeyToJWK = %+v, want kty %q crv %q and no d", jwk, tt.kty, tt.crv)
+			}
+			tt.check(t, jwk, key)
+
+			jwk, err = PrivateKeyToJWK(key)
+			if err != nil {
+				t.Fatalf("PrivateKeyToJWK: %v", err)
+			}
+			if jwk.Kty != tt.kty || jwk.Crv != tt.crv || jwk.D == "" {
+				t.Errorf("PrivateKeyToJWK = %+v, want kty %q crv %q and d", jwk, tt.kty, tt.crv)
+			}
+			tt.check(t, jwk, key)
+		})
+	}
+
+	if _, err := PublicKeyToJWK("not a key"); err == nil {
+		t.Error("PublicKeyToJWK accepted a string")
+	}
+}
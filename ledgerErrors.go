@@ -0,0 +1,211 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// LedgerErrorKind is the category of an error reported in a transaction's
+// Summary.Errors.
+type LedgerErrorKind int
+
+const (
+	ErrorUnknown LedgerErrorKind = iota
+	// ErrorSignature: a signature is missing or does not verify.
+	ErrorSignature
+	// ErrorStreamNotFound: an input, output or read only stream does not exist.
+	ErrorStreamNotFound
+	// ErrorContractNotFound: the namespace or contract does not exist.
+	ErrorContractNotFound
+	// ErrorContractExecution: the contract rejected the transaction or threw.
+	ErrorContractExecution
+	// ErrorTerritoriality: the territoriality node did not take part.
+	ErrorTerritoriality
+	// ErrorVote: the network did not reach consensus.
+	ErrorVote
+	// ErrorConflict: a stream was locked or changed by another transaction.
+	// Sending the transaction again may succeed.
+	ErrorConflict
+)
+
+func (k LedgerErrorKind) String() string {
+	switch k {
+	case ErrorSignature:
+		return "signature"
+	case ErrorStreamNotFound:
+		return "stream not found"
+	case ErrorContractNotFound:
+		return "contract not found"
+	case ErrorContractExecution:
+		return "contract execution"
+	case ErrorTerritoriality:
+		return "territoriality"
+	case ErrorVote:
+		return "vote"
+	case ErrorConflict:
+		return "conflict"
+	}
+	return "unknown"
+}
+
+// LedgerError is one entry of a transaction's Summary.Errors.
+type LedgerError struct {
+	Kind LedgerErrorKind
+	// Node is the reference of the node that reported the error, empty when
+	// the message does not name one.
+	Node    string
+	Message string
+	// Retryable is set for errors the same transaction may not hit when
+	// sent again, such as stream lock conflicts.
+	Retryable bool
+}
+
+func (e LedgerError) Error() string {
+	if e.Node == "" {
+		return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%s: node %s: %s", e.Kind, e.Node, e.Message)
+}
+
+// TransactionError is returned by SendTransaction when the ledger reports
+// errors for the transaction.
+type TransactionError struct {
+	UMID   string
+	Errors []LedgerError
+}
+
+func (e *TransactionError) Error() string {
+	if len(e.Errors) == 0 {
+		return "Activeledger error, see response.Summary.Errors"
+	}
+	msg := "Activeledger error: " + e.Errors[0].Error()
+	if n := len(e.Errors) - 1; n > 0 {
+		msg += fmt.Sprintf(" (and %d more)", n)
+	}
+	return msg
+}
+
+// Has reports whether any of the errors is of kind.
+func (e *TransactionError) Has(kind LedgerErrorKind) bool {
+	for _, le := range e.Errors {
+		if le.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Retryable reports whether every error is retryable, so sending the
+// transaction again may succeed.
+func (e *TransactionError) Retryable() bool {
+	if len(e.Errors) == 0 {
+		return false
+	}
+	for _, le := range e.Errors {
+		if !le.Retryable {
+			return false
+		}
+	}
+	return true
+}
+
+// ClassifyErrors parses the entries of Summary.Errors.
+func ClassifyErrors(errs []string) []LedgerError {
+	out := make([]LedgerError, len(errs))
+	for i, s := range errs {
+		out[i] = ParseLedgerError(s)
+	}
+	return out
+}
+
+// ledgerErrorRules map words in an error message to its kind, checked in
+// order so the more specific rules win. A rule matches when the message
+// has one of its about words, if it lists any, and one of its phrases.
+// Words and phrases match whole words only, so "lock" does not match
+// "block", "clock" or "unlocked".
+var ledgerErrorRules = []struct {
+	kind    LedgerErrorKind
+	about   []string
+	phrases []string
+}{
+	{ErrorSignature, nil, []string{"signature", "signatures", "sigs", "selfsign", "self signed"}},
+	{ErrorTerritoriality, nil, []string{"territorial", "territoriality"}},
+	{ErrorConflict, nil, []string{"lock", "locks", "locked", "conflict", "conflicts", "busy", "in use", "position incorrect"}},
+	{ErrorContractNotFound, []string{"contract", "contracts", "namespace", "namespaces"}, notFoundPhrases},
+	{ErrorStreamNotFound, []string{"stream", "streams"}, notFoundPhrases},
+	{ErrorVote, nil, []string{"vote", "votes", "voting", "voted", "consensus"}},
+	{ErrorContractExecution, nil, []string{"contract", "vm", "reject", "rejected", "exception", "execute", "execution", "executing"}},
+}
+
+var notFoundPhrases = []string{"not found", "not exist", "doesn't exist", "missing", "unknown"}
+
+// ParseLedgerError parses one entry of Summary.Errors. Nodes report errors
+// as "<node reference> : <message>"; the reference is optional.
+func ParseLedgerError(s string) LedgerError {
+	e := LedgerError{Message: strings.TrimSpace(s)}
+	if i := strings.Index(e.Message, " : "); i > 0 && !strings.ContainsAny(e.Message[:i], " \t") {
+		e.Node, e.Message = e.Message[:i], strings.TrimSpace(e.Message[i+3:])
+	} else if strings.HasPrefix(e.Message, "[") {
+		if i := strings.IndexByte(e.Message, ']'); i > 1 {
+			e.Node, e.Message = e.Message[1:i], strings.TrimSpace(e.Message[i+1:])
+		}
+	}
+
+	words := messageWords(e.Message)
+	for _, rule := range ledgerErrorRules {
+		if (rule.about == nil || hasAnyPhrase(words, rule.about)) && hasAnyPhrase(words, rule.phrases) {
+			e.Kind = rule.kind
+			break
+		}
+	}
+	e.Retryable = e.Kind == ErrorConflict
+	return e
+}
+
+// messageWords splits a message into lower case words.
+func messageWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// hasAnyPhrase reports whether one of phrases, each one or more words,
+// appears in words.
+func hasAnyPhrase(words []string, phrases []string) bool {
+	for _, phrase := range phrases {
+		p := strings.Fields(phrase)
+		for i := 0; i+len(p) <= len(words); i++ {
+			j := 0
+			for j < len(p) && words[i+j] == p[j] {
+				j++
+			}
+			if j == len(p) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import "testing"
+
+func TestParseLedgerError(t *testing.T) {
+	tests := []struct {
+		in        string
+		node      string
+		kind      LedgerErrorKind
+		retryable bool
+	}{
+		{"a3f5c1d2 : Busy Locks", "a3f5c1d2", ErrorConflict, true},
+		{"a3f5c1d2 : Stream Position Incorrect", "a3f5c1d2", ErrorConflict, true},
+		{"[node-1] Stream locked by another transaction", "node-1", ErrorConflict, true},
+		{"a3f5c1d2 : Stream(s) not found", "a3f5c1d2", ErrorStreamNotFound, false},
+		{"a3f5c1d2 : Read only stream not found", "a3f5c1d2", ErrorStreamNotFound, false},
+		{"a3f5c1d2 : Contract Not Found", "a3f5c1d2", ErrorContractNotFound, false},
+		{"Namespace does not exist", "", ErrorContractNotFound, false},
+		{"a3f5c1d2 : Signature Incorrect", "a3f5c1d2", ErrorSignature, false},
+		{"Self signed signature not matching", "", ErrorSignature, false},
+		{"a3f5c1d2 : Failed to get territoriality", "a3f5c1d2", ErrorTerritoriality, false},
+		{"a3f5c1d2 : Failed Network Voting Round", "a3f5c1d2", ErrorVote, false},
+		{"a3f5c1d2 : VM Error : Balance too low", "a3f5c1d2", ErrorContractExecution, false},
+		{"a3f5c1d2 : Contract Execution Failed", "a3f5c1d2", ErrorContractExecution, false},
+		// lock must match as a whole word
+		{"a3f5c1d2 : Block height mismatch", "a3f5c1d2", ErrorUnknown, false},
+		{"Clock skew too large", "", ErrorUnknown, false},
+		{"Stream unlocked before commit", "", ErrorUnknown, false},
+		{"", "", ErrorUnknown, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			e := ParseLedgerError(tt.in)
+			if e.Node != tt.node || e.Kind != tt.kind || e.Retryable != tt.retryable {
+				t.Errorf("got node %q kind %s retryable %v, want node %q kind %s retryable %v",
+					e.Node, e.Kind, e.Retryable, tt.node, tt.kind, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestTransactionErrorRetryable(t *testing.T) {
+	conflict := &TransactionError{Errors: ClassifyErrors([]string{"n1 : Busy Locks", "n2 : Stream Position Incorrect"})}
+	if !conflict.Retryable() {
+		t.Error("conflicts should be retryable")
+	}
+	mixed := &TransactionError{Errors: ClassifyErrors([]string{"n1 : Busy Locks", "n2 : Contract Not Found"})}
+	if mixed.Retryable() {
+		t.Error("a contract error should not be retryable")
+	}
+	if !mixed.Has(ErrorContractNotFound) || mixed.Has(ErrorSignature) {
+		t.Error("Has reports the wrong kinds")
+	}
+	if (&TransactionError{}).Retryable() {
+		t.Error("no errors should not be retryable")
+	}
+}
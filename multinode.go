@@ -0,0 +1,216 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NodeStats reports how one node of a MultiSubscription is keeping up.
+type NodeStats struct {
+	Host  string
+	State ConnState
+	// Events counts the events received from the node, Duplicates those
+	// another node delivered first.
+	Events     int
+	Duplicates int
+	// Lag is how long after the first node this node delivered its last
+	// event, 0 when it was first.
+	Lag       time.Duration
+	LastEvent time.Time
+}
+
+// MultiSubscription subscribes to the same topic on several nodes at once
+// and delivers each event once, so consumers survive a node going down.
+type MultiSubscription struct {
+	topic  Topic
+	subs   []*Subscription
+	events chan Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu    sync.Mutex
+	stats []NodeStats
+	seen  map[string]time.Time
+	ring  []string
+	next  int
+}
+
+// ErrNoNodes is returned when a MultiSubscription is given no hosts.
+var ErrNoNodes = errors.New("subscription: no nodes to subscribe to")
+
+// NewMultiSubscription subscribes to topic on every host, host:http://ip:port
+func NewMultiSubscription(hosts []string, topic Topic, opts SubscribeOptions) (*MultiSubscription, error) {
+	if len(hosts) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &MultiSubscription{
+		topic:  topic,
+		events: make(chan Event),
+		ctx:    ctx,
+		cancel: cancel,
+		stats:  make([]NodeStats, len(hosts)),
+		seen:   make(map[string]time.Time, recentIDSize),
+		ring:   make([]string, recentIDSize),
+	}
+
+	onState := opts.OnStateChange
+	for i, host := range hosts {
+		m.stats[i].Host = host
+
+		nodeOpts := opts
+		if nodeOpts.Checkpoints != nil {
+			nodeOpts.CheckpointKey = host + string(topic)
+		}
+		i := i
+		nodeOpts.OnStateChange = func(state ConnState, err error) {
+			m.mu.Lock()
+			m.stats[i].State = state
+			m.mu.Unlock()
+			if onState != nil {
+				onState(state, err)
+			}
+		}
+
+		sub, err := NewSubscription(host, topic, nodeOpts)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.subs = append(m.subs, sub)
+	}
+
+	for i, sub := range m.subs {
+		m.wg.Add(1)
+		go m.forward(i, sub)
+	}
+	go func() {
+		m.wg.Wait()
+		close(m.events)
+	}()
+	return m, nil
+}
+
+// SubscribeNodes subscribes to topic on every online node known to the node
+// at host. resolve turns a node reference from GetNodeReferences into the
+// node's host, http://ip:port
+func SubscribeNodes(host string, resolve func(reference string) string, topic Topic, opts SubscribeOptions) (*MultiSubscription, error) {
+	var hosts []string
+	for _, ref := range GetNodeReferences(host) {
+		if h := resolve(ref); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+	return NewMultiSubscription(hosts, topic, opts)
+}
+
+// Events returns the channel events are delivered on. It is closed once the
+// subscription is closed.
+func (m *MultiSubscription) Events() <-chan Event {
+	return m.events
+}
+
+// Stats returns a snapshot of each node's statistics.
+func (m *MultiSubscription) Stats() []NodeStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]NodeStats(nil), m.stats...)
+}
+
+// Close stops the subscriptions to every node.
+func (m *MultiSubscription) Close() error {
+	m.cancel()
+	for _, sub := range m.subs {
+		sub.Close()
+	}
+	return nil
+}
+
+func (m *MultiSubscription) forward(node int, sub *Subscription) {
+	defer m.wg.Done()
+
+	for ev := range sub.Events() {
+		if !m.first(node, eventKey(m.topic, ev)) {
+			continue
+		}
+		select {
+		case m.events <- ev:
+		case <-m.ctx.Done():
+			return
+		}
+	}
+}
+
+// first records an event from node and reports whether no other node
+// delivered it before.
+func (m *MultiSubscription) first(node int, key string) bool {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := &m.stats[node]
+	st.Events++
+	st.LastEvent = now
+
+	if at, ok := m.seen[key]; ok {
+		st.Duplicates++
+		st.Lag = now.Sub(at)
+		return false
+	}
+	st.Lag = 0
+
+	if old := m.ring[m.next]; old != "" {
+		delete(m.seen, old)
+	}
+	m.ring[m.next] = key
+	m.next = (m.next + 1) % len(m.ring)
+	m.seen[key] = now
+	return true
+}
+
+// eventKey identifies an event independently of the node that sent it:
+// stream changes by stream and revision, contract events by UMID.
+func eventKey(topic Topic, ev Event) string {
+	if strings.HasPrefix(string(topic), string(ActivityTopic())) {
+		if a, err := ParseActivityEvent(ev); err == nil && a.Revision != "" {
+			return "rev:" + a.StreamID + "@" + a.Revision
+		}
+	} else if c, err := ParseContractEvent(ev); err == nil && c.UMID != "" {
+		return "umid:" + c.UMID + ":" + c.Contract + ":" + c.Name + ":" + hashString(string(c.Payload))
+	}
+	return "raw:" + hashString(ev.Raw)
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
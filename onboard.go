@@ -1,6 +1,7 @@
 package sdk
 
 import (
+	"crypto"
 	"crypto/rsa"
 	"encoding/json"
 
@@ -8,60 +9,46 @@ import (
 )
 
 func onboardRSA(keyPair *rsa.PrivateKey, encryption Encryption, keyname string) (Response, error) {
+	return Onboard(keyPair, encryption, keyname)
+}
 
-	var tx = new(Transaction)
-	tx.TxObject.Contract = "onboard"
-	tx.TxObject.Namespace = "default"
-	input := make(map[string]interface{})
-	inputMap := make(map[string]interface{})
-	pubKey := RsaToPem(keyPair.PublicKey)
-
-	inputMap["publicKey"] = pubKey
-
-	inputMap["type"] = Encrptype[encryption]
-	input[keyname] = inputMap
-	tx.TxObject.Input = input
-	tx.SelfSign = true
-	sig := make(map[string]interface{})
-	b, _ := json.Marshal(tx.TxObject)
-	sign, _ := RsaSign(*keyPair, b)
-	sig[keyname] = sign
-
-	tx.Signature = sig
-	//ll, _ := json.Marshal(tx)
+func onboardEC(keyPair *bitecdsa.PrivateKey, encryption Encryption, keyname string) (Response, error) {
+	return Onboard(keyPair, encryption, keyname)
+}
 
-	resp, errResp := SendTransaction(*tx, GetUrl())
-	if errResp != nil {
-		return Response{}, errResp
-	}
+// Onboard registers the public half of key on the ledger as a new identity
+// stream called keyname. Works for any registered Encryption.
+func Onboard(key crypto.PrivateKey, encryption Encryption, keyname string) (Response, error) {
 
-	if len(resp.Streams.New) > 0 {
-		Stream = resp.Streams.New[0].ID // storing stream id in local storage
-		KeyName = keyname
+	alg, err := encryption.Algorithm()
+	if err != nil {
+		return Response{}, err
 	}
-	return resp, nil
-}
-
-func onboardEC(keyPair *bitecdsa.PrivateKey, encryption Encryption, keyname string) (Response, error) {
 
 	var tx = new(Transaction)
 	tx.TxObject.Contract = "onboard"
 	tx.TxObject.Namespace = "default"
 	input := make(map[string]interface{})
 	inputMap := make(map[string]interface{})
-	_, pubKey := EcdsaToPem(keyPair)
+	pubKey, err := alg.PublicPem(key)
+	if err != nil {
+		return Response{}, err
+	}
 
 	inputMap["publicKey"] = pubKey
-	inputMap["type"] = encryption
+	inputMap["type"] = Encrptype[encryption]
 	input[keyname] = inputMap
 	tx.TxObject.Input = input
 	tx.SelfSign = true
 	sig := make(map[string]interface{})
 	b, _ := json.Marshal(tx.TxObject)
-	sign := EcdsaSign(keyPair, string(b))
+	sign, err := alg.Sign(key, b)
+	if err != nil {
+		return Response{}, err
+	}
 	sig[keyname] = sign
 	tx.Signature = sig
-	
+
 	resp, errResp := SendTransaction(*tx, GetUrl())
 	if errResp != nil {
 		return Response{}, errResp
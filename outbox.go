@@ -0,0 +1,611 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// OutboxState is where a queued transaction is in its life.
+type OutboxState int
+
+const (
+	// OutboxPending transactions are waiting to be sent, or were being sent
+	// when the process stopped and will be sent again.
+	OutboxPending OutboxState = iota
+	// OutboxSent transactions were accepted by the node.
+	OutboxSent
+	// OutboxFailed transactions were rejected by the node.
+	OutboxFailed
+	// OutboxDuplicate transactions were sent again after a crash and the
+	// node answered with a UMID already recorded, so they had already
+	// been delivered.
+	OutboxDuplicate
+)
+
+func (s OutboxState) String() string {
+	switch s {
+	case OutboxPending:
+		return "pending"
+	case OutboxSent:
+		return "sent"
+	case OutboxFailed:
+		return "failed"
+	case OutboxDuplicate:
+		return "duplicate"
+	}
+	return "unknown"
+}
+
+// OutboxEntry is a transaction in an Outbox.
+type OutboxEntry struct {
+	ID          uint64
+	Transaction Transaction
+	State       OutboxState
+	// Attempts counts the times sending was started.
+	Attempts int
+	UMID     string
+	Summary  Summary
+	// Error is the node's reason for rejecting the transaction.
+	Error string
+}
+
+// outboxRecord is one line of the outbox log.
+type outboxRecord struct {
+	Op      string          `json:"op"`
+	ID      uint64          `json:"id"`
+	Tx      json.RawMessage `json:"tx,omitempty"`
+	Key     string          `json:"key,omitempty"`
+	Time    *time.Time      `json:"time,omitempty"`
+	UMID    string          `json:"umid,omitempty"`
+	Summary *Summary        `json:"summary,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// Outbox operations written to the log.
+const (
+	opEnqueue   = "enqueue"
+	opAttempt   = "attempt"
+	opSent      = "sent"
+	opFailed    = "failed"
+	opDuplicate = "duplicate"
+)
+
+type outboxEntry struct {
+	OutboxEntry
+	raw json.RawMessage
+	key string
+	// attempted is when sending was first started, zero if never or
+	// unknown
+	attempted time.Time
+}
+
+// OutboxOptions configures an Outbox.
+type OutboxOptions struct {
+	// MaxAttempts bounds the sends of a transaction the ledger keeps
+	// rejecting with retryable errors, such as stream lock conflicts. Once
+	// an entry's Attempts reach it the rejection is recorded as failed, so
+	// the queue moves on. 10 when zero.
+	MaxAttempts int
+}
+
+// Outbox is a durable queue of signed transactions for when the node cannot
+// be reached. It is an append-only log file: every transaction queued,
+// every attempt to send one and every outcome is written and synced before
+// going further, so after a crash the queue picks up where it was.
+//
+// Delivery is at least once. Before a transaction whose send was cut short
+// is sent again, the recent history of the streams it touches is searched
+// for it, and if it was committed the entry is marked OutboxSent with its
+// UMID. Otherwise it is sent again; if the node then answers with a UMID
+// already in the log, or rejects it as a duplicate, the entry is marked
+// OutboxDuplicate. Queueing the same signed transaction twice returns the
+// existing entry, also after Compact.
+type Outbox struct {
+	path string
+	file *os.File
+	opts OutboxOptions
+
+	send sync.Mutex // held while flushing, so sends stay in order
+
+	mu      sync.Mutex
+	entries []*outboxEntry
+	byID    map[uint64]*outboxEntry
+	byKey   map[string]*outboxEntry
+	umids   map[string]uint64
+	nextID  uint64
+}
+
+// OpenOutbox opens the outbox log at path, creating it if needed, and
+// replays it. A last line left incomplete by a crash is discarded; any other
+// record that cannot be read is an error, and the log is left as it is.
+func OpenOutbox(path string, opts OutboxOptions) (*Outbox, error) {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	o := &Outbox{
+		path:   path,
+		file:   f,
+		opts:   opts,
+		byID:   make(map[uint64]*outboxEntry),
+		byKey:  make(map[string]*outboxEntry),
+		umids:  make(map[string]uint64),
+		nextID: 1,
+	}
+
+	good, err := o.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return o, nil
+}
+
+// replay applies the log and returns the length of its complete records.
+func (o *Outbox) replay(r io.Reader) (int64, error) {
+	br := bufio.NewReader(r)
+	var good int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			// an unterminated last line is a write cut short, never synced
+			return good, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		var rec outboxRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return 0, fmt.Errorf("outbox %s: bad record at byte %d: %w", o.path, good, err)
+		}
+		o.apply(rec)
+		good += int64(len(line))
+	}
+}
+
+// apply updates the in-memory queue with a log record.
+func (o *Outbox) apply(rec outboxRecord) {
+	if rec.Op == opEnqueue {
+		e := &outboxEntry{raw: rec.Tx, key: rec.Key}
+		e.ID = rec.ID
+		if rec.Tx != nil {
+			if err := decodeTransaction(rec.Tx, &e.Transaction); err != nil {
+				e.State, e.Error = OutboxFailed, err.Error()
+			}
+			e.key = txKey(rec.Tx)
+		}
+		if e.key != "" {
+			o.byKey[e.key] = e
+		}
+		o.entries = append(o.entries, e)
+		o.byID[e.ID] = e
+		if rec.ID >= o.nextID {
+			o.nextID = rec.ID + 1
+		}
+		return
+	}
+
+	e := o.byID[rec.ID]
+	if e == nil {
+		return
+	}
+	switch rec.Op {
+	case opAttempt:
+		e.Attempts++
+		if rec.Time != nil && e.attempted.IsZero() {
+			e.attempted = *rec.Time
+		}
+	case opSent, opDuplicate, opFailed:
+		e.State = map[string]OutboxState{opSent: OutboxSent, opDuplicate: OutboxDuplicate, opFailed: OutboxFailed}[rec.Op]
+		e.UMID, e.Error = rec.UMID, rec.Error
+		if rec.Summary != nil {
+			e.Summary = *rec.Summary
+		}
+		if rec.UMID != "" && rec.Op != opDuplicate {
+			o.umids[rec.UMID] = rec.ID
+		}
+	}
+}
+
+// write appends a record to the log and syncs it to disk.
+func (o *Outbox) write(rec outboxRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := o.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return o.file.Sync()
+}
+
+// Enqueue adds a signed transaction to the end of the queue and returns its
+// entry ID. A transaction already queued is not added again.
+func (o *Outbox) Enqueue(transaction Transaction) (uint64, error) {
+	raw, err := json.Marshal(transaction)
+	if err != nil {
+		return 0, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if e, ok := o.byKey[txKey(raw)]; ok {
+		return e.ID, nil
+	}
+	rec := outboxRecord{Op: opEnqueue, ID: o.nextID, Tx: raw}
+	if err := o.write(rec); err != nil {
+		return 0, err
+	}
+	o.apply(rec)
+	return rec.ID, nil
+}
+
+// Entry returns the entry with the given ID.
+func (o *Outbox) Entry(id uint64) (OutboxEntry, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e, ok := o.byID[id]
+	if !ok {
+		return OutboxEntry{}, false
+	}
+	return e.OutboxEntry, true
+}
+
+// Entries returns every entry in queue order.
+func (o *Outbox) Entries() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	out := make([]OutboxEntry, len(o.entries))
+	for i, e := range o.entries {
+		out[i] = e.OutboxEntry
+	}
+	return out
+}
+
+// Pending returns the entries still to be sent, in queue order.
+func (o *Outbox) Pending() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var out []OutboxEntry
+	for _, e := range o.entries {
+		if e.State == OutboxPending {
+			out = append(out, e.OutboxEntry)
+		}
+	}
+	return out
+}
+
+/*
+Flush sends the pending transactions in queue order. A transaction the node
+rejects is recorded as failed and the next one is sent. When the node
+cannot be reached Flush stops and returns the error, leaving that
+transaction and the ones after it queued.
+host:http://ip:port
+*/
+func (o *Outbox) Flush(ctx context.Context, host string) error {
+	o.send.Lock()
+	defer o.send.Unlock()
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		e := o.next()
+		if e == nil {
+			return nil
+		}
+		if err := o.deliver(ctx, e, host); err != nil {
+			return err
+		}
+	}
+}
+
+// Run flushes the queue every interval until ctx is done, so transactions
+// go out as soon as the node can be reached again.
+func (o *Outbox) Run(ctx context.Context, host string, interval time.Duration) error {
+	for {
+		o.Flush(ctx, host)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (o *Outbox) next() *outboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, e := range o.entries {
+		if e.State == OutboxPending {
+			return e
+		}
+	}
+	return nil
+}
+
+// deliver sends one entry and records the outcome. It returns an error only
+// when the outcome is unknown and the entry stays pending.
+func (o *Outbox) deliver(ctx context.Context, e *outboxEntry, host string) error {
+	var tx Transaction
+	if err := decodeTransaction(e.raw, &tx); err != nil {
+		return o.record(outboxRecord{Op: opFailed, ID: e.ID, Error: err.Error()})
+	}
+
+	o.mu.Lock()
+	inDoubt, attempted := e.Attempts > 0, e.attempted
+	o.mu.Unlock()
+	if inDoubt {
+		// an earlier send has no recorded outcome, it may have been committed
+		umid, err := findCommitted(ctx, host, tx, attempted)
+		if err != nil {
+			return err
+		}
+		if umid != "" {
+			return o.record(outboxRecord{Op: opSent, ID: e.ID, UMID: umid})
+		}
+	}
+
+	now := time.Now()
+	if err := o.record(outboxRecord{Op: opAttempt, ID: e.ID, Time: &now}); err != nil {
+		return err
+	}
+	resp, err := SendTransaction(tx, host)
+
+	o.mu.Lock()
+	prev, known := o.umids[resp.UMID]
+	attempts := e.Attempts
+	o.mu.Unlock()
+
+	rec := outboxRecord{ID: e.ID, UMID: resp.UMID, Summary: &resp.Summary}
+	var txErr *TransactionError
+	switch {
+	case err != nil && len(resp.Summary.Errors) == 0:
+		// no answer from the ledger: the node is unreachable or failing
+		return err
+	case errors.As(err, &txErr) && txErr.Retryable() && attempts < o.opts.MaxAttempts:
+		// a conflict which may clear, so keep it queued in order
+		return err
+	case err != nil:
+		rec.Op, rec.Error = opFailed, err.Error()
+	default:
+		rec.Op = opSent
+	}
+
+	resent := attempts > 1
+	if (known && resp.UMID != "" && prev != e.ID) || (resent && rec.Op == opFailed && duplicateRejection(resp.Summary.Errors)) {
+		rec.Op, rec.Error = opDuplicate, ""
+	}
+	return o.record(rec)
+}
+
+// inDoubtSkew allows for the node's clock being behind ours when searching
+// for a transaction committed after an attempt started.
+const inDoubtSkew = 5 * time.Minute
+
+// findCommitted searches the streams a transaction touches, newest revision
+// first, for a committed transaction carrying the same signatures. It stops
+// at revisions committed before since, when that is known, and returns ""
+// when the transaction is not found.
+func findCommitted(ctx context.Context, host string, tx Transaction, since time.Time) (string, error) {
+	for _, id := range affectedStreams(tx) {
+		history, err := streamHistory(ctx, host, id)
+		var httpErr *HTTPError
+		if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		for _, h := range history {
+			if !h.available {
+				continue
+			}
+			doc, err := streamRevision(ctx, host, id, h.rev)
+			if errors.Is(err, ErrRevisionNotFound) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			umid := stringField(doc, "$umid", "umid")
+			if umid == "" {
+				continue
+			}
+			record, err := fetchTransaction(ctx, host, umid)
+			if errors.Is(err, ErrTransactionNotFound) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			if sameSignatures(tx, record) {
+				return umid, nil
+			}
+			if !since.IsZero() && !record.Datetime.IsZero() && record.Datetime.Before(since.Add(-inDoubtSkew)) {
+				break
+			}
+		}
+	}
+	return "", nil
+}
+
+// sameSignatures reports whether a committed transaction carries exactly
+// the signatures of tx, and so is tx.
+func sameSignatures(tx Transaction, record *TransactionRecord) bool {
+	if len(tx.Signature) == 0 || len(tx.Signature) != len(record.Signatures) {
+		return false
+	}
+	for signer, v := range tx.Signature {
+		sig, ok := v.(string)
+		if !ok || sig == "" || record.Signatures[signer] != sig {
+			return false
+		}
+	}
+	return true
+}
+
+// duplicatePhrases are the words a node rejects a transaction it has
+// processed already with, matched as whole words like ledgerErrorRules.
+var duplicatePhrases = []string{"duplicate", "duplicated", "already processed", "already been processed", "already committed"}
+
+// duplicateRejection reports whether the node rejected a transaction for
+// having processed it already.
+func duplicateRejection(errs []string) bool {
+	for _, e := range errs {
+		if hasAnyPhrase(messageWords(e), duplicatePhrases) {
+			return true
+		}
+	}
+	return false
+}
+
+// record writes and applies a record.
+func (o *Outbox) record(rec outboxRecord) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.write(rec); err != nil {
+		return err
+	}
+	o.apply(rec)
+	return nil
+}
+
+// Compact rewrites the log without the transactions of settled entries,
+// keeping their keys, outcomes and UMIDs for duplicate detection. The file
+// is replaced atomically.
+func (o *Outbox) Compact() error {
+	o.send.Lock()
+	defer o.send.Unlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range o.entries {
+		if e.State == OutboxPending {
+			enc.Encode(outboxRecord{Op: opEnqueue, ID: e.ID, Tx: e.raw})
+			// attempts without an outcome are looked up before resending
+			for i := 0; i < e.Attempts; i++ {
+				rec := outboxRecord{Op: opAttempt, ID: e.ID}
+				if i == 0 && !e.attempted.IsZero() {
+					attempted := e.attempted
+					rec.Time = &attempted
+				}
+				enc.Encode(rec)
+			}
+			continue
+		}
+		// settled entries keep only what duplicate detection needs
+		enc.Encode(outboxRecord{Op: opEnqueue, ID: e.ID, Key: e.key})
+		op := map[OutboxState]string{OutboxSent: opSent, OutboxFailed: opFailed, OutboxDuplicate: opDuplicate}[e.State]
+		summary := e.Summary
+		enc.Encode(outboxRecord{Op: op, ID: e.ID, UMID: e.UMID, Summary: &summary, Error: e.Error})
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), filepath.Base(o.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), o.path); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	o.file.Close()
+	o.file = tmp
+	if _, err := tmp.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	o.entries = nil
+	o.byID = make(map[uint64]*outboxEntry)
+	o.byKey = make(map[string]*outboxEntry)
+	o.umids = make(map[string]uint64)
+	_, err = o.replay(&buf)
+	return err
+}
+
+// Close closes the log file.
+func (o *Outbox) Close() error {
+	o.send.Lock()
+	defer o.send.Unlock()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Close()
+}
+
+// decodeTransaction decodes a queued transaction keeping numbers as they
+// were written, so it marshals back to the bytes that were signed.
+func decodeTransaction(raw json.RawMessage, tx *Transaction) error {
+	if raw == nil {
+		return errors.New("transaction compacted away")
+	}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	return d.Decode(tx)
+}
+
+// txKey identifies a signed transaction by its content.
+func txKey(raw json.RawMessage) string {
+	if raw == nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,372 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ledgerNode answers transactions with the responses queued in answers, and
+// serves the streams and transaction records in docs by path.
+type ledgerNode struct {
+	*httptest.Server
+	mu      sync.Mutex
+	answers []string
+	posts   int
+	docs    map[string]string
+}
+
+func newLedgerNode(t *testing.T, answers ...string) *ledgerNode {
+	t.Helper()
+	n := &ledgerNode{answers: answers, docs: make(map[string]string)}
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if r.Method == "POST" {
+			io.Copy(io.Discard, r.Body)
+			n.posts++
+			if len(n.answers) == 0 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			io.WriteString(w, n.answers[0])
+			if len(n.answers) > 1 {
+				n.answers = n.answers[1:]
+			}
+			return
+		}
+		key := r.URL.Path
+		if rev := r.URL.Query().Get("rev"); rev != "" {
+			key += "?rev=" + rev
+		}
+		doc, ok := n.docs[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, doc)
+	}))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func committed(umid string) string {
+	return fmt.Sprintf(`{"$umid":%q,"$summary":{"total":1,"vote":1,"commit":1}}`, umid)
+}
+
+func rejected(msg string) string {
+	return fmt.Sprintf(`{"$umid":"r","$summary":{"total":1,"vote":0,"commit":0,"errors":[%q]}}`, msg)
+}
+
+func outboxTx(sig string) Transaction {
+	return Transaction{
+		TxObject:  TxObject{Namespace: "default", Contract: "c", Input: map[string]interface{}{"s1": map[string]interface{}{"n": 1}}},
+		Signature: map[string]interface{}{"s1": sig},
+	}
+}
+
+func openTestOutbox(t *testing.T, path string, opts OutboxOptions) *Outbox {
+	t.Helper()
+	o, err := OpenOutbox(path, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { o.Close() })
+	return o
+}
+
+func enqueue(t *testing.T, o *Outbox, tx Transaction) uint64 {
+	t.Helper()
+	id, err := o.Enqueue(tx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return id
+}
+
+func checkEntry(t *testing.T, o *Outbox, id uint64, state OutboxState, umid string) {
+	t.Helper()
+	e, ok := o.Entry(id)
+	if !ok {
+		t.Fatalf("entry %d missing", id)
+	}
+	if e.State != state || e.UMID != umid {
+		t.Errorf("entry %d is %s %q, want %s %q", id, e.State, e.UMID, state, umid)
+	}
+}
+
+func TestOutboxFlush(t *testing.T) {
+	n := newLedgerNode(t, committed("u1"), rejected("n1 : Contract Not Found"))
+	o := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.log"), OutboxOptions{})
+	a := enqueue(t, o, outboxTx("A"))
+	b := enqueue(t, o, outboxTx("B"))
+	if again := enqueue(t, o, outboxTx("A")); again != a {
+		t.Errorf("re-enqueued as %d, want %d", again, a)
+	}
+
+	if err := o.Flush(context.Background(), n.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkEntry(t, o, a, OutboxSent, "u1")
+	checkEntry(t, o, b, OutboxFailed, "r")
+	if len(o.Pending()) != 0 {
+		t.Errorf("pending %v", o.Pending())
+	}
+}
+
+func TestOutboxUnreachable(t *testing.T) {
+	n := newLedgerNode(t)
+	o := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox.log"), OutboxOptions{})
+	id := enqueue(t, o, outboxTx("A"))
+	if err := o.Flush(context.Background(), n.URL); err == nil {
+		t.Fatal("want an error")
+	}
+	checkEntry(t, o, id, OutboxPending, "")
+}
+
+func TestOutboxTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	o, err := OpenOutbox(path, OutboxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := enqueue(t, o, outboxTx("A"))
+	o.Close()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"enqueue","id":2,"tx":{"$tx`)
+	f.Close()
+
+	o = openTestOutbox(t, path, OutboxOptions{})
+	if got := len(o.Entries()); got != 1 {
+		t.Errorf("%d entries, want 1", got)
+	}
+	checkEntry(t, o, id, OutboxPending, "")
+	if next := enqueue(t, o, outboxTx("B")); next != 2 {
+		t.Errorf("next entry %d, want 2", next)
+	}
+	o.Close()
+
+	o = openTestOutbox(t, path, OutboxOptions{})
+	if got := len(o.Entries()); got != 2 {
+		t.Errorf("%d entries after reopening, want 2", got)
+	}
+}
+
+func TestOutboxCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	o, err := OpenOutbox(path, OutboxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueue(t, o, outboxTx("A"))
+	o.Close()
+
+	b, _ := os.ReadFile(path)
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	f.WriteString("not json\n")
+	f.Write(b)
+	f.Close()
+	before, _ := os.ReadFile(path)
+
+	if _, err := OpenOutbox(path, OutboxOptions{}); err == nil {
+		t.Fatal("a bad record before others should be an error")
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Error("the log was changed")
+	}
+}
+
+// crashedSend leaves an attempt without an outcome, as a crash mid-send does.
+func crashedSend(t *testing.T, path string, tx Transaction) uint64 {
+	t.Helper()
+	o, err := OpenOutbox(path, OutboxOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := enqueue(t, o, tx)
+	now := time.Now()
+	if err := o.record(outboxRecord{Op: opAttempt, ID: id, Time: &now}); err != nil {
+		t.Fatal(err)
+	}
+	o.Close()
+	return id
+}
+
+func TestOutboxInDoubtCommitted(t *testing.T) {
+	n := newLedgerNode(t, committed("again"))
+	n.docs["/api/stream/s1"] = `{"stream":{"_id":"s1","_rev":"2-b","$umid":"u2","_revs_info":[{"rev":"2-b","status":"available"},{"rev":"1-a","status":"available"}]}}`
+	n.docs["/api/stream/s1?rev=1-a"] = `{"stream":{"_id":"s1","_rev":"1-a","$umid":"u1"}}`
+	n.docs["/api/tx/u2"] = `{"$umid":"u2","$tx":{},"$sigs":{"s1":"other"}}`
+	n.docs["/api/tx/u1"] = `{"$umid":"u1","$tx":{},"$sigs":{"s1":"A"}}`
+
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	id := crashedSend(t, path, outboxTx("A"))
+	o := openTestOutbox(t, path, OutboxOptions{})
+	if err := o.Flush(context.Background(), n.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkEntry(t, o, id, OutboxSent, "u1")
+	if n.posts != 0 {
+		t.Errorf("sent %d times, want 0", n.posts)
+	}
+}
+
+func TestOutboxInDoubtResent(t *testing.T) {
+	n := newLedgerNode(t, committed("u9"))
+	// records are cached by UMID across tests, so this one has its own
+	n.docs["/api/stream/s1"] = `{"stream":{"_id":"s1","_rev":"1-c","$umid":"u5"}}`
+	n.docs["/api/tx/u5"] = `{"$umid":"u5","$tx":{},"$sigs":{"s1":"other"}}`
+
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	id := crashedSend(t, path, outboxTx("A"))
+	o := openTestOutbox(t, path, OutboxOptions{})
+	if err := o.Flush(context.Background(), n.URL); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	checkEntry(t, o, id, OutboxSent, "u9")
+	if n.posts != 1 {
+		t.Errorf("sent %d times, want 1", n.posts)
+	}
+}
+
+func TestOutboxDuplicates(t *testing.T) {
+	// the node answers the resend of A with the UMID it gave before
+	n := newLedgerNode(t, committed("u1"), committed("u1"), rejected("n1 : Transaction already processed"))
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	o := openTestOutbox(t, path, OutboxOptions{})
+	a := enqueue(t, o, outboxTx("A"))
+	if err := o.Flush(context.Background(), n.URL); err != nil {
+		t.Fatal(err)
+	}
+	b := enqueue(t, o, outboxTx("A2"))
+	if err := o.Flush(context.Background(), n.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkEntry(t, o, a, OutboxSent, "u1")
+	checkEntry(t, o, b, OutboxDuplicate, "u1")
+	o.Close()
+
+	// a resend rejected as already processed is a duplicate too
+	id := crashedSend(t, path, outboxTx("C"))
+	o = openTestOutbox(t, path, OutboxOptions{})
+	if err := o.Flush(context.Background(), n.URL); err != nil {
+		t.Fatal(err)
+	}
+	checkEntry(t, o, id, OutboxDuplicate, "r")
+}
+
+func TestOutboxCompact(t *testing.T) {
+	n := newLedgerNode(t, committed("u1"), rejected("n1 : Contract Not Found"))
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	o := openTestOutbox(t, path, OutboxOptions{})
+	sent := enqueue(t, o, outboxTx("A"))
+	failed := enqueue(t, o, outboxTx("B"))
+	if err := o.Flush(context.Background(), n.URL); err != nil {
+		t.Fatal(err)
+	}
+	pending := enqueue(t, o, outboxTx("C"))
+	if err := o.Compact(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	o.Close()
+
+	b, _ := os.ReadFile(path)
+	var tx json.RawMessage
+	for _, line := range splitLines(b) {
+		var rec outboxRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Tx != nil && rec.ID != pending {
+			t.Errorf("settled entry %d kept its transaction", rec.ID)
+		}
+		if rec.ID == pending {
+			tx = rec.Tx
+		}
+	}
+	if tx == nil {
+		t.Error("pending entry lost its transaction")
+	}
+
+	o = openTestOutbox(t, path, OutboxOptions{})
+	for _, tt := range []struct {
+		tx Transaction
+		id uint64
+	}{{outboxTx("A"), sent}, {outboxTx("B"), failed}, {outboxTx("C"), pending}} {
+		if id := enqueue(t, o, tt.tx); id != tt.id {
+			t.Errorf("re-enqueued as %d, want %d", id, tt.id)
+		}
+	}
+	checkEntry(t, o, sent, OutboxSent, "u1")
+	checkEntry(t, o, failed, OutboxFailed, "r")
+	checkEntry(t, o, pending, OutboxPending, "")
+}
+
+func splitLines(b []byte) [][]byte {
+	var lines [][]byte
+	for len(b) > 0 {
+		i := 0
+		for i < len(b) && b[i] != '\n' {
+			i++
+		}
+		lines = append(lines, b[:i])
+		if i < len(b) {
+			i++
+		}
+		b = b[i:]
+	}
+	return lines
+}
+
+func TestDuplicateRejection(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{"n1 : Duplicate transaction", true},
+		{"n1 : Transaction already processed", true},
+		{"n1 : Transaction has already been processed", true},
+		{"n1 : Stream already locked", false},
+		{"n1 : Busy Locks", false},
+		{"n1 : Contract Not Found", false},
+	}
+	for _, tt := range tests {
+		if got := duplicateRejection([]string{tt.msg}); got != tt.want {
+			t.Errorf("duplicateRejection(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
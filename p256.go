@@ -0,0 +1,147 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/pem"
+	"errors"
+)
+
+/*
+Generate a pair of NIST P-256 (secp256r1) private and public key.
+Output: Private key object.
+Public key can be extracted using
+publicKey:=key.PublicKey
+*/
+func P256KeyGen() (*ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	P256Key = key
+	KeyType = Encrptype[P256]
+	return key, nil
+}
+
+/*
+Sign a transaction using your private key. Data is hashed using SHA256 before signing.
+Input: Private Key,Transaction byte array
+Output: base64 DER signature
+*/
+func P256Sign(prv *ecdsa.PrivateKey, data []byte) (string, error) {
+	h := sha256.Sum256(data)
+
+	der, err := ecdsa.SignASN1(rand.Reader, prv, h[:])
+	if err != nil {
+		return "", err
+	}
+	return b64.StdEncoding.EncodeToString(der), nil
+}
+
+/*
+Verify a signature made by P256Sign.
+Input: Public Key, signed data, base64 DER signature
+Output: nil when the signature is valid
+*/
+func P256Verify(pub *ecdsa.PublicKey, data []byte, sig string) error {
+	der, err := b64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(pub, h[:], der) {
+		return errors.New("secp256r1: signature verification failed")
+	}
+	return nil
+}
+
+/*
+Convert Private key object into SEC1 PEM Private & PKIX PEM Public
+Input: Private key
+Output: Pem formatted private and public key
+*/
+func P256ToPem(prv *ecdsa.PrivateKey) (string, string, error) {
+	prvBytes, err := x509.MarshalECPrivateKey(prv)
+	if err != nil {
+		return "", "", err
+	}
+	pubBytes, err := x509.MarshalPKIXPublicKey(&prv.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	prvPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: prvBytes})
+	pubPem := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubBytes})
+	return string(prvPem), string(pubPem), nil
+}
+
+/*
+Convert PEM to Private key object
+Input: Pem encoded private key(String)
+Output: Private key object
+*/
+func P256FromPem(pemEncoded string) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("secp256r1: no PEM block found")
+	}
+
+	prv, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if prv.Curve != elliptic.P256() {
+		return nil, errors.New("secp256r1: PEM block is not a P-256 private key")
+	}
+	return prv, nil
+}
+
+/*
+Convert a PEM encoded public key back into a key object.
+Input: Pem encoded public key(String)
+Output: Public key object
+*/
+func P256PublicFromPem(pemEncoded string) (*ecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("secp256r1: no PEM block found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, errors.New("secp256r1: PEM block is not a P-256 public key")
+	}
+	return pub, nil
+}
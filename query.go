@@ -0,0 +1,406 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Query builds a stream search for SearchActivityStreamGet, as Activeledger's
+// SQL-like syntax, or for SearchActivityStreamPost, as a Mango query. Values
+// are kept apart from the query text and escaped when it is rendered, so
+// they cannot change the query's meaning.
+//
+//	q := sdk.Select().From("X").Where(sdk.Eq("namespace", ns), sdk.Gt("amount", 10)).Limit(20)
+//	sql, err := q.SQL()
+type Query struct {
+	fields []string
+	from   string
+	where  []Condition
+	order  []sortField
+	limit  int
+	offset int
+}
+
+type sortField struct {
+	field string
+	desc  bool
+}
+
+// Condition is a filter in a Query's WHERE clause.
+type Condition interface {
+	writeSQL(sb *strings.Builder) error
+	mango() (map[string]interface{}, error)
+}
+
+// Select starts a query returning fields, or every field when none are given.
+func Select(fields ...string) *Query {
+	return &Query{fields: fields}
+}
+
+// From sets the table the query reads, "X" when not set.
+func (q *Query) From(table string) *Query {
+	q.from = table
+	return q
+}
+
+// Where adds conditions which must all hold.
+func (q *Query) Where(conds ...Condition) *Query {
+	q.where = append(q.where, conds...)
+	return q
+}
+
+// OrderBy sorts the results by field, ascending.
+func (q *Query) OrderBy(field string) *Query {
+	q.order = append(q.order, sortField{field: field})
+	return q
+}
+
+// OrderByDesc sorts the results by field, descending.
+func (q *Query) OrderByDesc(field string) *Query {
+	q.order = append(q.order, sortField{field: field, desc: true})
+	return q
+}
+
+// Limit caps the number of results.
+func (q *Query) Limit(n int) *Query {
+	q.limit = n
+	return q
+}
+
+// Offset skips the first n results.
+func (q *Query) Offset(n int) *Query {
+	q.offset = n
+	return q
+}
+
+// SQL renders the query for SearchActivityStreamGet.
+func (q *Query) SQL() (string, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if len(q.fields) == 0 {
+		sb.WriteString("*")
+	}
+	for i, f := range q.fields {
+		if err := checkField(f); err != nil {
+			return "", err
+		}
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(f)
+	}
+
+	from := q.from
+	if from == "" {
+		from = "X"
+	}
+	if err := checkField(from); err != nil {
+		return "", err
+	}
+	sb.WriteString(" FROM " + from)
+
+	if len(q.where) > 0 {
+		sb.WriteString(" WHERE ")
+		if err := And(q.where...).writeSQL(&sb); err != nil {
+			return "", err
+		}
+	}
+
+	for i, o := range q.order {
+		if err := checkField(o.field); err != nil {
+			return "", err
+		}
+		if i == 0 {
+			sb.WriteString(" ORDER BY ")
+		} else {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(o.field)
+		if o.desc {
+			sb.WriteString(" DESC")
+		} else {
+			sb.WriteString(" ASC")
+		}
+	}
+	if q.limit > 0 {
+		sb.WriteString(" LIMIT " + strconv.Itoa(q.limit))
+	}
+	if q.offset > 0 {
+		sb.WriteString(" OFFSET " + strconv.Itoa(q.offset))
+	}
+	return sb.String(), nil
+}
+
+// Mango renders the query as a Mango query document.
+func (q *Query) Mango() (map[string]interface{}, error) {
+	selector := map[string]interface{}{}
+	if len(q.where) > 0 {
+		var err error
+		if selector, err = And(q.where...).mango(); err != nil {
+			return nil, err
+		}
+	}
+
+	doc := map[string]interface{}{"selector": selector}
+	if len(q.fields) > 0 {
+		for _, f := range q.fields {
+			if err := checkField(f); err != nil {
+				return nil, err
+			}
+		}
+		doc["fields"] = q.fields
+	}
+	if len(q.order) > 0 {
+		sort := make([]map[string]string, len(q.order))
+		for i, o := range q.order {
+			if err := checkField(o.field); err != nil {
+				return nil, err
+			}
+			dir := "asc"
+			if o.desc {
+				dir = "desc"
+			}
+			sort[i] = map[string]string{o.field: dir}
+		}
+		doc["sort"] = sort
+	}
+	if q.limit > 0 {
+		doc["limit"] = q.limit
+	}
+	if q.offset > 0 {
+		doc["skip"] = q.offset
+	}
+	return doc, nil
+}
+
+// JSON renders the query as the body for SearchActivityStreamPost.
+func (q *Query) JSON() (map[string]interface{}, error) {
+	mango, err := q.Mango()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"mango": mango}, nil
+}
+
+var fieldPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*(\.[A-Za-z_$][A-Za-z0-9_$]*)*$`)
+
+// checkField rejects names that could not be used as a field unquoted.
+func checkField(field string) error {
+	if !fieldPattern.MatchString(field) {
+		return fmt.Errorf("query: invalid field name %q", field)
+	}
+	return nil
+}
+
+// writeValue writes v as an escaped SQL literal.
+func writeValue(sb *strings.Builder, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		sb.WriteString("NULL")
+	case string:
+		sb.WriteByte('\'')
+		for _, r := range v {
+			switch r {
+			case '\'':
+				sb.WriteString("''")
+			case '\\':
+				sb.WriteString(`\\`)
+			default:
+				sb.WriteRune(r)
+			}
+		}
+		sb.WriteByte('\'')
+	case bool:
+		if v {
+			sb.WriteString("TRUE")
+		} else {
+			sb.WriteString("FALSE")
+		}
+	case int:
+		sb.WriteString(strconv.Itoa(v))
+	case int32:
+		sb.WriteString(strconv.FormatInt(int64(v), 10))
+	case int64:
+		sb.WriteString(strconv.FormatInt(v, 10))
+	case uint:
+		sb.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint32:
+		sb.WriteString(strconv.FormatUint(uint64(v), 10))
+	case uint64:
+		sb.WriteString(strconv.FormatUint(v, 10))
+	case float32:
+		if err := checkFloat(float64(v)); err != nil {
+			return err
+		}
+		sb.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		if err := checkFloat(v); err != nil {
+			return err
+		}
+		sb.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		return fmt.Errorf("query: unsupported value type %T", v)
+	}
+	return nil
+}
+
+// checkFloat rejects NaN and infinities, which have no SQL or JSON literal.
+func checkFloat(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("query: unsupported number %v", f)
+	}
+	return nil
+}
+
+type comparison struct {
+	field string
+	op    string
+	mop   string
+	value interface{}
+}
+
+func (c comparison) writeSQL(sb *strings.Builder) error {
+	if err := checkField(c.field); err != nil {
+		return err
+	}
+	sb.WriteString(c.field + " " + c.op + " ")
+	return writeValue(sb, c.value)
+}
+
+func (c comparison) mango() (map[string]interface{}, error) {
+	if err := checkField(c.field); err != nil {
+		return nil, err
+	}
+	if err := writeValue(&strings.Builder{}, c.value); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{c.field: map[string]interface{}{c.mop: c.value}}, nil
+}
+
+// Eq matches streams where field equals value.
+func Eq(field string, value interface{}) Condition { return comparison{field, "=", "$eq", value} }
+
+// Ne matches streams where field does not equal value.
+func Ne(field string, value interface{}) Condition { return comparison{field, "!=", "$ne", value} }
+
+// Gt matches streams where field is greater than value.
+func Gt(field string, value interface{}) Condition { return comparison{field, ">", "$gt", value} }
+
+// Gte matches streams where field is greater than or equal to value.
+func Gte(field string, value interface{}) Condition { return comparison{field, ">=", "$gte", value} }
+
+// Lt matches streams where field is less than value.
+func Lt(field string, value interface{}) Condition { return comparison{field, "<", "$lt", value} }
+
+// Lte matches streams where field is less than or equal to value.
+func Lte(field string, value interface{}) Condition { return comparison{field, "<=", "$lte", value} }
+
+type inCondition struct {
+	field  string
+	values []interface{}
+}
+
+// In matches streams where field equals one of values.
+func In(field string, values ...interface{}) Condition { return inCondition{field, values} }
+
+func (c inCondition) writeSQL(sb *strings.Builder) error {
+	if err := checkField(c.field); err != nil {
+		return err
+	}
+	if len(c.values) == 0 {
+		return fmt.Errorf("query: IN on %s has no values", c.field)
+	}
+	sb.WriteString(c.field + " IN (")
+	for i, v := range c.values {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		if err := writeValue(sb, v); err != nil {
+			return err
+		}
+	}
+	sb.WriteString(")")
+	return nil
+}
+
+func (c inCondition) mango() (map[string]interface{}, error) {
+	if err := c.writeSQL(&strings.Builder{}); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{c.field: map[string]interface{}{"$in": c.values}}, nil
+}
+
+type logical struct {
+	op    string
+	mop   string
+	conds []Condition
+}
+
+// And matches streams meeting every condition.
+func And(conds ...Condition) Condition { return logical{"AND", "$and", conds} }
+
+// Or matches streams meeting any condition.
+func Or(conds ...Condition) Condition { return logical{"OR", "$or", conds} }
+
+func (l logical) writeSQL(sb *strings.Builder) error {
+	if len(l.conds) == 0 {
+		return fmt.Errorf("query: %s has no conditions", l.op)
+	}
+	if len(l.conds) == 1 {
+		return l.conds[0].writeSQL(sb)
+	}
+	sb.WriteString("(")
+	for i, c := range l.conds {
+		if i > 0 {
+			sb.WriteString(" " + l.op + " ")
+		}
+		if err := c.writeSQL(sb); err != nil {
+			return err
+		}
+	}
+	sb.WriteString(")")
+	return nil
+}
+
+func (l logical) mango() (map[string]interface{}, error) {
+	if len(l.conds) == 0 {
+		return nil, fmt.Errorf("query: %s has no conditions", l.op)
+	}
+	if len(l.conds) == 1 {
+		return l.conds[0].mango()
+	}
+	parts := make([]interface{}, len(l.conds))
+	for i, c := range l.conds {
+		m, err := c.mango()
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = m
+	}
+	return map[string]interface{}{l.mop: parts}, nil
+}
@@ -0,0 +1,145 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestQuerySQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		query *Query
+		want  string
+	}{
+		{
+			name:  "defaults",
+			query: Select(),
+			want:  "SELECT * FROM X",
+		},
+		{
+			name:  "quotes are doubled",
+			query: Select("name").Where(Eq("name", "O'Brien")),
+			want:  "SELECT name FROM X WHERE name = 'O''Brien'",
+		},
+		{
+			name:  "injection stays inside the literal",
+			query: Select().Where(Eq("a", "x' OR '1'='1")),
+			want:  "SELECT * FROM X WHERE a = 'x'' OR ''1''=''1'",
+		},
+		{
+			name:  "backslashes are escaped",
+			query: Select().Where(Eq("path", `C:\tmp\'`)),
+			want:  `SELECT * FROM X WHERE path = 'C:\\tmp\\'''`,
+		},
+		{
+			name:  "literals",
+			query: Select().Where(Eq("a", nil), Ne("b", true), Gt("c", -3), Lte("d", 1.5), Lt("e", uint64(7))),
+			want:  "SELECT * FROM X WHERE (a = NULL AND b != TRUE AND c > -3 AND d <= 1.5 AND e < 7)",
+		},
+		{
+			name:  "in",
+			query: Select().Where(In("state", "open", "it's", 3)),
+			want:  "SELECT * FROM X WHERE state IN ('open', 'it''s', 3)",
+		},
+		{
+			name: "or nested in and",
+			query: Select("a", "b.c").From("Y").
+				Where(Eq("a", 1), Or(In("b.c", "x", "y"), And(Gt("d", 2), Lt("d", 5)))).
+				OrderByDesc("a").OrderBy("b.c").Limit(10).Offset(20),
+			want: "SELECT a, b.c FROM Y WHERE (a = 1 AND (b.c IN ('x', 'y') OR (d > 2 AND d < 5))) ORDER BY a DESC, b.c ASC LIMIT 10 OFFSET 20",
+		},
+		{
+			name:  "single condition is not wrapped",
+			query: Select().Where(Or(Eq("a", "b"))),
+			want:  "SELECT * FROM X WHERE a = 'b'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.query.SQL()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   *Query
+		sqlOnly bool
+	}{
+		{"field with space", Select("a b"), false},
+		{"field with quote", Select().Where(Eq("a'--", 1)), false},
+		{"field starting with digit", Select().Where(Eq("1a", 1)), false},
+		{"empty field", Select().OrderBy(""), false},
+		{"trailing dot", Select().Where(In("a.", 1)), false},
+		{"bad table", Select().From("X; DROP"), true},
+		{"empty in", Select().Where(In("a")), false},
+		{"empty or", Select().Where(Or()), false},
+		{"bad field nested in or", Select().Where(Or(Eq("a", 1), And(Eq("b c", 2), Eq("d", 3)))), false},
+		{"unsupported value", Select().Where(Eq("a", struct{}{})), false},
+		{"nan", Select().Where(Eq("a", math.NaN())), false},
+		{"inf", Select().Where(Gt("a", math.Inf(1))), false},
+		{"negative inf in in", Select().Where(In("a", 1, float32(math.Inf(-1)))), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.query.SQL(); err == nil {
+				t.Errorf("SQL() = %q, want an error", got)
+			}
+			if tt.sqlOnly {
+				// Mango queries have no table
+				return
+			}
+			if got, err := tt.query.Mango(); err == nil {
+				t.Errorf("Mango() = %v, want an error", got)
+			}
+		})
+	}
+}
+
+func TestQueryMango(t *testing.T) {
+	q := Select("a").
+		Where(Eq("a", "O'Brien"), Or(In("b", "x", 2), Gte("c", 1.5))).
+		OrderByDesc("a").Limit(5).Offset(10)
+	body, err := q.JSON()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `{"mango":{"fields":["a"],"limit":5,"selector":{"$and":[{"a":{"$eq":"O'Brien"}},{"$or":[{"b":{"$in":["x",2]}},{"c":{"$gte":1.5}}]}]},"skip":10,"sort":[{"a":"desc"}]}}`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,279 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// OverflowPolicy decides what a subscription does with a new event when its
+// buffer is full.
+type OverflowPolicy int
+
+// Overflow policies
+const (
+	// OverflowBlock stops reading from the node until the consumer catches up.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest buffered event.
+	OverflowDropOldest
+	// OverflowDropNewest discards the new event.
+	OverflowDropNewest
+	// OverflowSpill writes events to a file on disk until the consumer
+	// catches up, keeping their order.
+	OverflowSpill
+)
+
+// SubscriptionStats counts the events a subscription has buffered and lost.
+type SubscriptionStats struct {
+	// Buffered is the number of events waiting for the consumer, in memory
+	// or on disk.
+	Buffered int
+	Dropped  uint64
+	// Spilled is the number of events that have been written to disk.
+	Spilled uint64
+}
+
+// eventQueue buffers events between a subscription's connection and its
+// consumer, applying an OverflowPolicy when full. It has a single producer
+// and a single consumer.
+type eventQueue struct {
+	size     int
+	policy   OverflowPolicy
+	spillDir string
+
+	mu      sync.Mutex
+	events  []Event
+	spill   *spillFile
+	dropped uint64
+	spilled uint64
+
+	ready chan struct{} // signalled when events are added
+	space chan struct{} // signalled when events are removed
+}
+
+func newEventQueue(size int, policy OverflowPolicy, spillDir string) *eventQueue {
+	return &eventQueue{
+		size:     size,
+		policy:   policy,
+		spillDir: spillDir,
+		events:   make([]Event, 0, size),
+		ready:    make(chan struct{}, 1),
+		space:    make(chan struct{}, 1),
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push adds ev, blocking under OverflowBlock. It returns false when ctx is
+// done first.
+func (q *eventQueue) push(ctx context.Context, ev Event) bool {
+	for {
+		q.mu.Lock()
+		switch {
+		case q.spill != nil && q.spill.pending > 0:
+			// events already on disk are older, so this one follows them
+			q.spillEvent(ev)
+		case len(q.events) < q.size:
+			q.events = append(q.events, ev)
+		case q.policy == OverflowDropOldest:
+			q.events = append(q.events[1:], ev)
+			q.dropped++
+		case q.policy == OverflowDropNewest:
+			q.dropped++
+		case q.policy == OverflowSpill:
+			q.spillEvent(ev)
+		default:
+			q.mu.Unlock()
+			select {
+			case <-q.space:
+				continue
+			case <-ctx.Done():
+				return false
+			}
+		}
+		q.mu.Unlock()
+		signal(q.ready)
+		return true
+	}
+}
+
+// spillEvent writes ev to disk, dropping it if that fails. q.mu is held.
+func (q *eventQueue) spillEvent(ev Event) {
+	if q.spill == nil {
+		spill, err := openSpillFile(q.spillDir)
+		if err != nil {
+			q.dropped++
+			return
+		}
+		q.spill = spill
+	}
+	if err := q.spill.write(ev); err != nil {
+		q.dropped++
+		return
+	}
+	q.spilled++
+}
+
+// pop removes the oldest event, blocking until there is one. It returns
+// false when ctx is done first.
+func (q *eventQueue) pop(ctx context.Context) (Event, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.events) == 0 && q.spill != nil && q.spill.pending > 0 {
+			events, err := q.spill.read(q.size)
+			if err != nil {
+				// the rest of the file cannot be read back
+				q.dropped += uint64(q.spill.pending)
+				q.spill.reset()
+			}
+			q.events = append(q.events, events...)
+		}
+		if len(q.events) > 0 {
+			ev := q.events[0]
+			q.events[0] = Event{}
+			q.events = q.events[1:]
+			q.mu.Unlock()
+			signal(q.space)
+			return ev, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.ready:
+		case <-ctx.Done():
+			return Event{}, false
+		}
+	}
+}
+
+func (q *eventQueue) stats() SubscriptionStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	st := SubscriptionStats{Buffered: len(q.events), Dropped: q.dropped, Spilled: q.spilled}
+	if q.spill != nil {
+		st.Buffered += q.spill.pending
+	}
+	return st
+}
+
+// close removes the spill file.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.spill != nil {
+		q.spill.close()
+		q.spill = nil
+	}
+}
+
+// spillFile is an append-only file of JSON encoded events, read back in order.
+type spillFile struct {
+	w       *os.File
+	rf      *os.File
+	r       *bufio.Reader
+	pending int
+}
+
+// spilledEvent is the on disk form of an event; Data is decoded from Raw again.
+type spilledEvent struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	Raw  string `json:"raw"`
+}
+
+func openSpillFile(dir string) (*spillFile, error) {
+	w, err := os.CreateTemp(dir, "activeledger-events-*")
+	if err != nil {
+		return nil, err
+	}
+	rf, err := os.Open(w.Name())
+	if err != nil {
+		w.Close()
+		os.Remove(w.Name())
+		return nil, err
+	}
+	return &spillFile{w: w, rf: rf, r: bufio.NewReader(rf)}, nil
+}
+
+func (s *spillFile) write(ev Event) error {
+	b, err := json.Marshal(spilledEvent{Name: ev.Name, ID: ev.ID, Raw: ev.Raw})
+	if err != nil {
+		return err
+	}
+	if _, err := s.w.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.pending++
+	return nil
+}
+
+// read returns up to n of the oldest events, emptying the file once all
+// have been read.
+func (s *spillFile) read(n int) ([]Event, error) {
+	var events []Event
+	for len(events) < n && s.pending > 0 {
+		line, err := s.r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return events, err
+		}
+		var se spilledEvent
+		if err := json.Unmarshal(line, &se); err != nil {
+			return events, err
+		}
+		events = append(events, newEvent(se.Name, se.ID, se.Raw))
+		s.pending--
+	}
+	if s.pending == 0 {
+		s.reset()
+	}
+	return events, nil
+}
+
+// reset empties the file so it does not grow while the consumer keeps up.
+func (s *spillFile) reset() {
+	s.pending = 0
+	s.w.Truncate(0)
+	s.w.Seek(0, io.SeekStart)
+	s.rf.Seek(0, io.SeekStart)
+	s.r.Reset(s.rf)
+}
+
+func (s *spillFile) close() {
+	s.rf.Close()
+	s.w.Close()
+	os.Remove(s.w.Name())
+}
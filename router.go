@@ -0,0 +1,331 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// EventHandler handles an event routed to it by an EventRouter.
+type EventHandler func(ctx context.Context, ev Event) error
+
+// Route selects the events a handler receives. Empty fields match any event.
+type Route struct {
+	Contract  string
+	EventName string
+	StreamID  string
+	// Activity routes stream changes rather than contract events. It is
+	// implied when StreamID is set.
+	Activity bool
+	// Match is a custom predicate checked after the fields above.
+	Match func(Event) bool
+	// Workers is the number of events handled at once, 1 when zero, which
+	// keeps the route's events in order.
+	Workers int
+}
+
+// topic is the subscription a route needs.
+func (rt Route) topic() Topic {
+	switch {
+	case rt.StreamID != "":
+		return StreamTopic(rt.StreamID)
+	case rt.Activity:
+		return ActivityTopic()
+	case rt.Contract != "" && rt.EventName != "":
+		return ContractEventTopic(rt.Contract, rt.EventName)
+	case rt.Contract != "":
+		return ContractTopic(rt.Contract)
+	}
+	return AllEventsTopic()
+}
+
+func (rt Route) matches(ev Event) bool {
+	switch {
+	case rt.StreamID != "":
+		a, err := ParseActivityEvent(ev)
+		if err != nil || a.StreamID != rt.StreamID {
+			return false
+		}
+	case rt.Activity:
+	case rt.Contract != "" || rt.EventName != "":
+		c, err := ParseContractEvent(ev)
+		if err != nil {
+			return false
+		}
+		if rt.Contract != "" && c.Contract != "" && c.Contract != rt.Contract {
+			return false
+		}
+		if rt.EventName != "" && c.Name != rt.EventName {
+			return false
+		}
+	}
+	return rt.Match == nil || rt.Match(ev)
+}
+
+// RouterOptions configures an EventRouter.
+type RouterOptions struct {
+	// Subscribe configures the subscriptions the router opens, one per
+	// topic. With Checkpoints set, each topic's checkpoint is saved once
+	// every event up to it has been handled or passed to DeadLetter, and
+	// CheckpointKey, when set, is prefixed to the topic to name it.
+	Subscribe SubscribeOptions
+	// QueueSize is the number of events buffered for each route, 64 when
+	// zero. An event arriving while its route's queue is full is not
+	// handled but passed to DeadLetter with ErrRouteQueueFull, so a slow
+	// handler never holds up the other routes.
+	QueueSize int
+	// DeadLetter receives events whose handler failed or panicked, or whose
+	// route's queue was full. Such events are dropped when it is nil.
+	DeadLetter func(ev Event, err error)
+}
+
+var (
+	// ErrNoRoutes is returned by Run when no handlers have been registered.
+	ErrNoRoutes = errors.New("router: no routes registered")
+	// ErrRouteQueueFull is passed to DeadLetter for events dropped because
+	// their route's queue was full.
+	ErrRouteQueueFull = errors.New("router: route queue full")
+)
+
+// EventRouter opens the subscriptions its routes need and dispatches each
+// event to the matching handlers, running them on a bounded pool per route.
+type EventRouter struct {
+	host   string
+	opts   RouterOptions
+	routes []*routeEntry
+}
+
+type routeEntry struct {
+	route   Route
+	handler EventHandler
+	queue   chan routedEvent
+}
+
+// routedEvent is an event queued for a route, with its place in the topic's
+// checkpoint order when checkpoints are saved.
+type routedEvent struct {
+	ev      Event
+	pending *pendingEvent
+}
+
+// NewEventRouter creates a router for the node at host, host:http://ip:port
+func NewEventRouter(host string, opts RouterOptions) *EventRouter {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 64
+	}
+	return &EventRouter{host: host, opts: opts}
+}
+
+// Handle registers a handler for the events selected by route. Handlers must
+// be registered before Run is called.
+func (r *EventRouter) Handle(route Route, h EventHandler) {
+	if route.Workers <= 0 {
+		route.Workers = 1
+	}
+	r.routes = append(r.routes, &routeEntry{route: route, handler: h})
+}
+
+// Run subscribes and dispatches events until ctx is done.
+func (r *EventRouter) Run(ctx context.Context) error {
+	if len(r.routes) == 0 {
+		return ErrNoRoutes
+	}
+
+	byTopic := make(map[Topic][]*routeEntry)
+	var topics []Topic
+	for _, entry := range r.routes {
+		t := entry.route.topic()
+		if _, ok := byTopic[t]; !ok {
+			topics = append(topics, t)
+		}
+		byTopic[t] = append(byTopic[t], entry)
+	}
+
+	var subs []*Subscription
+	for _, t := range topics {
+		opts := r.opts.Subscribe
+		if opts.Checkpoints != nil && opts.CheckpointKey != "" {
+			opts.CheckpointKey += string(t)
+		}
+		sub, err := NewSubscription(r.host, t, opts)
+		if err != nil {
+			for _, s := range subs {
+				s.Close()
+			}
+			return err
+		}
+		subs = append(subs, sub)
+	}
+
+	var workers sync.WaitGroup
+	for _, entry := range r.routes {
+		entry.queue = make(chan routedEvent, r.opts.QueueSize)
+		for i := 0; i < entry.route.Workers; i++ {
+			workers.Add(1)
+			go func(entry *routeEntry) {
+				defer workers.Done()
+				for item := range entry.queue {
+					item.pending.done(r.handle(ctx, entry, item.ev))
+				}
+			}(entry)
+		}
+	}
+
+	var readers sync.WaitGroup
+	for i, sub := range subs {
+		readers.Add(1)
+		go func(sub *Subscription, entries []*routeEntry) {
+			defer readers.Done()
+			var acks *topicAcks
+			if r.opts.Subscribe.Checkpoints != nil {
+				acks = &topicAcks{sub: sub}
+			}
+			var matched []*routeEntry
+			for ev := range sub.Events() {
+				matched = matched[:0]
+				for _, entry := range entries {
+					if entry.route.matches(ev) {
+						matched = append(matched, entry)
+					}
+				}
+				pending := acks.track(ev, len(matched))
+				for _, entry := range matched {
+					select {
+					case entry.queue <- routedEvent{ev: ev, pending: pending}:
+					default:
+						pending.done(r.deadLetter(ev, ErrRouteQueueFull))
+					}
+				}
+			}
+		}(sub, byTopic[topics[i]])
+	}
+
+	<-ctx.Done()
+	for _, sub := range subs {
+		sub.Close()
+	}
+	readers.Wait()
+	for _, entry := range r.routes {
+		close(entry.queue)
+	}
+	workers.Wait()
+	return nil
+}
+
+// handle runs a handler, turning a panic into an error for the dead letter
+// hook. It reports whether the event was handled or dead-lettered.
+func (r *EventRouter) handle(ctx context.Context, entry *routeEntry, ev Event) bool {
+	err := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("router: handler panic: %v", p)
+			}
+		}()
+		return entry.handler(ctx, ev)
+	}()
+
+	if err != nil {
+		return r.deadLetter(ev, err)
+	}
+	return true
+}
+
+// deadLetter passes ev to the dead letter hook, reporting whether there is one.
+func (r *EventRouter) deadLetter(ev Event, err error) bool {
+	if r.opts.DeadLetter == nil {
+		return false
+	}
+	r.opts.DeadLetter(ev, err)
+	return true
+}
+
+// topicAcks acknowledges a topic's events in the order they arrived, once
+// every route they were queued for has settled them. An event that was lost,
+// failing without a dead letter hook, stops the checkpoint there so it is
+// delivered again after a restart.
+type topicAcks struct {
+	mu      sync.Mutex
+	sub     *Subscription
+	pending []*pendingEvent
+	stalled bool
+}
+
+type pendingEvent struct {
+	acks      *topicAcks
+	ev        Event
+	remaining int
+	lost      bool
+}
+
+// track adds ev, queued for routes routes, to the acknowledgement order. It
+// returns nil when checkpoints are off or stalled.
+func (a *topicAcks) track(ev Event, routes int) *pendingEvent {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stalled {
+		return nil
+	}
+	p := &pendingEvent{acks: a, ev: ev, remaining: routes}
+	a.pending = append(a.pending, p)
+	a.advance()
+	return p
+}
+
+// done records one route settling the event, ok false when it was lost.
+func (p *pendingEvent) done(ok bool) {
+	if p == nil {
+		return
+	}
+	a := p.acks
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p.remaining--
+	if !ok {
+		p.lost = true
+	}
+	a.advance()
+}
+
+// advance acknowledges the settled events at the front of the order. Errors
+// saving the checkpoint are ignored: the events are delivered again.
+func (a *topicAcks) advance() {
+	var last *pendingEvent
+	for len(a.pending) > 0 && a.pending[0].remaining == 0 {
+		if a.pending[0].lost {
+			a.stalled = true
+			a.pending = nil
+			break
+		}
+		last = a.pending[0]
+		a.pending = a.pending[1:]
+	}
+	if last != nil {
+		a.sub.Ack(last.ev)
+	}
+}
@@ -0,0 +1,178 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventNode publishes n contract events on every connection, resuming after
+// Last-Event-ID, then holds the connection open. When pace is not nil each
+// event after the first waits for a value from it.
+func eventNode(t *testing.T, n int, pace <-chan struct{}) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		start := 1
+		fmt.Sscan(r.Header.Get("Last-Event-ID"), &start)
+		if r.Header.Get("Last-Event-ID") != "" {
+			start++
+		}
+		for i := start; i <= n; i++ {
+			if pace != nil && i > start {
+				select {
+				case <-pace:
+				case <-r.Context().Done():
+					return
+				}
+			}
+			fmt.Fprintf(w, "id: %d\ndata: {\"contract\":\"c\",\"name\":\"e\",\"data\":%d}\n\n", i, i)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRouterSlowRoute(t *testing.T) {
+	// the node sends each event once the fast route has handled the last
+	pace := make(chan struct{}, 1)
+	srv := eventNode(t, 10, pace)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var dropped int
+	router := NewEventRouter(srv.URL, RouterOptions{
+		QueueSize: 1,
+		DeadLetter: func(ev Event, err error) {
+			if errors.Is(err, ErrRouteQueueFull) {
+				mu.Lock()
+				dropped++
+				mu.Unlock()
+			}
+		},
+	})
+	block := make(chan struct{})
+	router.Handle(Route{Contract: "c"}, func(ctx context.Context, ev Event) error {
+		<-block
+		return nil
+	})
+	fast := make(chan Event, 10)
+	router.Handle(Route{Contract: "c", Match: func(Event) bool { return true }}, func(ctx context.Context, ev Event) error {
+		fast <- ev
+		pace <- struct{}{}
+		return nil
+	})
+
+	done := make(chan error)
+	go func() { done <- router.Run(ctx) }()
+	for i := 0; i < 10; i++ {
+		select {
+		case <-fast:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast route got %d events, want 10", i)
+		}
+	}
+	cancel()
+	close(block)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// one event is being handled and one queued, the rest were dropped
+	if dropped != 8 {
+		t.Errorf("dropped %d events, want 8", dropped)
+	}
+}
+
+func TestRouterCheckpoints(t *testing.T) {
+	srv := eventNode(t, 5, nil)
+	store := NewMemoryCheckpointStore()
+
+	// run routes two topics, the activity route failing event 3 without a
+	// dead letter hook, until each route has had the number of events given
+	// and returns the IDs the activity route was given
+	run := func(contracts, activities int) []string {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		router := NewEventRouter(srv.URL, RouterOptions{
+			Subscribe: SubscribeOptions{Checkpoints: store, CheckpointKey: "app"},
+		})
+		contract := make(chan Event, 5)
+		router.Handle(Route{Contract: "c"}, func(ctx context.Context, ev Event) error {
+			contract <- ev
+			return nil
+		})
+		activity := make(chan Event, 5)
+		router.Handle(Route{Activity: true}, func(ctx context.Context, ev Event) error {
+			activity <- ev
+			if ev.ID == "3" {
+				return errors.New("failed")
+			}
+			return nil
+		})
+
+		done := make(chan error)
+		go func() { done <- router.Run(ctx) }()
+		var ids []string
+		timeout := time.After(5 * time.Second)
+		for contracts > 0 || len(ids) < activities {
+			select {
+			case <-contract:
+				contracts--
+			case ev := <-activity:
+				ids = append(ids, ev.ID)
+			case <-timeout:
+				t.Fatalf("timed out with activity events %v", ids)
+			}
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return ids
+	}
+
+	run(5, 5)
+	for key, want := range map[string]string{
+		"app" + string(ContractTopic("c")): "5",
+		"app" + string(ActivityTopic()):    "2",
+	} {
+		if got, _ := store.Load(key); got != want {
+			t.Errorf("checkpoint %q = %q, want %q", key, got, want)
+		}
+	}
+
+	// after a restart the failed event is delivered again
+	if ids := run(0, 3); fmt.Sprint(ids) != "[3 4 5]" {
+		t.Errorf("after restart activity route got %v, want [3 4 5]", ids)
+	}
+}
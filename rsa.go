@@ -28,7 +28,9 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	b64 "encoding/base64"
 	"encoding/pem"
+	"errors"
 )
 
 /*
@@ -107,3 +109,44 @@ func RsaPrivToPem(prvkey rsa.PrivateKey) string {
 			Bytes: x509.MarshalPKCS1PrivateKey(&prvkey)})
 	return string(privkey_pem)
 }
+
+/*
+Verify a signature made by RsaSign. The signature is the base64 string found in a transaction's $sigs.
+Input: Public Key, signed data, base64 signature
+Output: nil when the signature is valid
+*/
+func RsaVerify(pub *rsa.PublicKey, data []byte, sig string) error {
+	sigBytes, err := b64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	h.Write(data)
+	d := h.Sum(nil)
+
+	return rsa.VerifyPKCS1v15(pub, crypto.SHA256, d, sigBytes)
+}
+
+/*
+Convert a PEM encoded public key, as stored by the onboard contract, back into a key object.
+Input: Pem formated public key
+Output: Public key object
+*/
+func RsaPublicFromPem(pemEncoded string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("rsa: no PEM block found")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("rsa: PEM block is not an RSA public key")
+	}
+	return rsaPub, nil
+}
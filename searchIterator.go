@@ -0,0 +1,298 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// SearchOptions configures a SearchIterator.
+type SearchOptions struct {
+	// PageSize is the number of streams requested at a time, 100 when zero.
+	PageSize int
+	// Client makes the requests, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// SearchIterator pages through the results of a stream search, decoding
+// each page from the response as it is read so no page is held in memory.
+//
+//	it := sdk.Search[Account](ctx, host, q, sdk.SearchOptions{})
+//	defer it.Close()
+//	for it.Next() {
+//		account, err := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type SearchIterator[T any] struct {
+	ctx   context.Context
+	host  string
+	query Query
+	opts  SearchOptions
+
+	body     io.ReadCloser
+	dec      *json.Decoder
+	offset   int
+	read     int // results read in total
+	pageRows int
+	bookmark string
+	last     bool
+
+	stream ActivityStream
+	err    error
+	done   bool
+}
+
+// Search runs q with SearchActivityStreamPost a page at a time. The query's
+// own Limit and Offset bound the results as a whole.
+func Search[T any](ctx context.Context, host string, q *Query, opts SearchOptions) *SearchIterator[T] {
+	if opts.PageSize <= 0 {
+		opts.PageSize = 100
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	return &SearchIterator[T]{ctx: ctx, host: host, query: *q, opts: opts, offset: q.offset}
+}
+
+// Next advances to the next stream, fetching another page when needed. It
+// returns false at the end of the results or on error.
+func (it *SearchIterator[T]) Next() bool {
+	for !it.done {
+		if it.query.limit > 0 && it.read >= it.query.limit {
+			it.finish(nil)
+			break
+		}
+		if it.dec == nil {
+			if it.last {
+				it.finish(nil)
+				break
+			}
+			if err := it.openPage(); err != nil {
+				it.finish(err)
+				break
+			}
+		}
+
+		if it.dec.More() {
+			var doc map[string]json.RawMessage
+			if err := it.dec.Decode(&doc); err != nil {
+				it.finish(err)
+				break
+			}
+			stream, err := ParseActivityStream(doc)
+			if err != nil {
+				it.finish(err)
+				break
+			}
+			it.stream = stream
+			it.pageRows++
+			it.read++
+			return true
+		}
+
+		if err := it.closePage(); err != nil {
+			it.finish(err)
+		}
+	}
+	return false
+}
+
+// Stream returns the current stream.
+func (it *SearchIterator[T]) Stream() ActivityStream {
+	return it.stream
+}
+
+// Value decodes the current stream's state. A stream that does not decode
+// does not stop the iteration.
+func (it *SearchIterator[T]) Value() (T, error) {
+	return DecodeState[T](it.stream)
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *SearchIterator[T]) Err() error {
+	return it.err
+}
+
+// Close stops the iteration early, releasing the current response.
+func (it *SearchIterator[T]) Close() error {
+	it.finish(nil)
+	return nil
+}
+
+func (it *SearchIterator[T]) finish(err error) {
+	if it.body != nil {
+		it.body.Close()
+		it.body = nil
+	}
+	it.dec = nil
+	if it.err == nil {
+		it.err = err
+	}
+	it.done = true
+}
+
+// openPage requests the next page and positions the decoder at the first
+// element of its "streams" list.
+func (it *SearchIterator[T]) openPage() error {
+	page := it.query
+	page.limit = it.opts.PageSize
+	if it.query.limit > 0 && it.query.limit-it.read < page.limit {
+		page.limit = it.query.limit - it.read
+	}
+	page.offset = it.offset
+
+	mango, err := page.Mango()
+	if err != nil {
+		return err
+	}
+	if it.bookmark != "" {
+		mango["bookmark"] = it.bookmark
+		delete(mango, "skip")
+	}
+	b, err := json.Marshal(map[string]interface{}{"mango": mango})
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(it.host)
+	if err != nil {
+		return err
+	}
+	rel, err := u.Parse("/api/stream/search")
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(it.ctx, "POST", rel.String(), bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := it.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return &HTTPError{URL: req.URL.String(), StatusCode: resp.StatusCode}
+	}
+
+	it.body = resp.Body
+	it.dec = json.NewDecoder(resp.Body)
+	it.pageRows = 0
+	it.bookmark = ""
+
+	if err := expectDelim(it.dec, '{'); err != nil {
+		return err
+	}
+	for it.dec.More() {
+		key, err := it.nextKey()
+		if err != nil {
+			return err
+		}
+		if key == "streams" {
+			return expectDelim(it.dec, '[')
+		}
+		if err := it.skipValue(key); err != nil {
+			return err
+		}
+	}
+	// no streams in the response, so the page is empty
+	it.last = true
+	return nil
+}
+
+// closePage reads what follows the "streams" list and decides whether
+// another page is needed.
+func (it *SearchIterator[T]) closePage() error {
+	if !it.last {
+		if err := expectDelim(it.dec, ']'); err != nil {
+			return err
+		}
+		for it.dec.More() {
+			key, err := it.nextKey()
+			if err != nil {
+				return err
+			}
+			if err := it.skipValue(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	it.body.Close()
+	it.body = nil
+	it.dec = nil
+
+	if it.pageRows < it.opts.PageSize {
+		it.last = true
+	}
+	it.offset += it.pageRows
+	return nil
+}
+
+func (it *SearchIterator[T]) nextKey() (string, error) {
+	tok, err := it.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", fmt.Errorf("search: unexpected token %v", tok)
+	}
+	return key, nil
+}
+
+// skipValue reads past a value other than "streams", keeping the bookmark
+// and reporting an error sent by the node.
+func (it *SearchIterator[T]) skipValue(key string) error {
+	var raw json.RawMessage
+	if err := it.dec.Decode(&raw); err != nil {
+		return err
+	}
+	switch key {
+	case "bookmark":
+		json.Unmarshal(raw, &it.bookmark)
+	case "error":
+		return fmt.Errorf("search: %s", raw)
+	}
+	return nil
+}
+
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("search: expected %v, got %v", want, tok)
+	}
+	return nil
+}
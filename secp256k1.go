@@ -31,6 +31,7 @@ import (
 	"encoding/asn1"
 	b64 "encoding/base64"
 	"encoding/pem"
+	"errors"
 	"math/big"
 )
 
@@ -202,3 +203,55 @@ func pointsToDER(r, s *big.Int) []byte {
 
 	return der
 }
+
+/*
+Verify a signature made by EcdsaSign.
+input: Public key, signed data, base64 DER signature
+output: nil when the signature is valid
+*/
+func EcdsaVerify(pub *bitecdsa.PublicKey, data []byte, sig string) error {
+	der, err := b64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return err
+	}
+
+	var points struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(der, &points); err != nil {
+		return err
+	}
+
+	h256 := sha256.New()
+	h256.Write(data)
+
+	if !bitecdsa.Verify(pub, h256.Sum(nil), points.R, points.S) {
+		return errors.New("secp256k1: signature verification failed")
+	}
+	return nil
+}
+
+/*
+Convert a PEM encoded public key, as created by EcdsaToPem, back into a key object.
+input: Pem encoded public key(String)
+output: Public key object
+*/
+func EcdsaPublicFromPem(pemEncoded string) (*bitecdsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemEncoded))
+	if block == nil {
+		return nil, errors.New("secp256k1: no PEM block found")
+	}
+
+	pemObject := new(pkixPublicKey)
+	if _, err := asn1.Unmarshal(block.Bytes, pemObject); err != nil {
+		return nil, err
+	}
+
+	pub := new(bitecdsa.PublicKey)
+	pub.BitCurve = bitelliptic.S256()
+	pub.X, pub.Y = pub.BitCurve.Unmarshal(pemObject.BitString.Bytes)
+	if pub.X == nil {
+		return nil, errors.New("secp256k1: invalid public key point")
+	}
+	return pub, nil
+}
@@ -0,0 +1,277 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a server sent event received from an Activeledger node.
+type Event struct {
+	// Name is the event type, "message" when the node does not set one.
+	Name string
+	ID   string
+	// Data is the payload decoded as a JSON object, nil when the payload is
+	// anything else. Raw always holds the payload as sent.
+	Data map[string]interface{}
+	Raw  string
+}
+
+// newEvent builds an event, decoding its payload when it is a JSON object.
+func newEvent(name string, id string, raw string) Event {
+	ev := Event{Name: name, ID: id, Raw: raw}
+	if strings.HasPrefix(raw, "{") {
+		var obj map[string]interface{}
+		if json.Unmarshal([]byte(raw), &obj) == nil {
+			ev.Data = obj
+		}
+	}
+	return ev
+}
+
+// eventReader parses a text/event-stream body as described by the WHATWG
+// HTML specification, section 9.2 "Server-sent events". It keeps the last
+// event ID and the server's reconnection time so a dropped stream can resume.
+type eventReader struct {
+	r      *bufio.Reader
+	lastID string
+	retry  time.Duration
+
+	started bool // the leading byte order mark has been checked
+	skipLF  bool // the previous line ended with CR, so a LF is not a new line
+	line    []byte
+	// ownID is set when the last event read had its own id field rather
+	// than carrying over the previous event's.
+	ownID bool
+}
+
+func newEventReader(r io.Reader) *eventReader {
+	return &eventReader{r: bufio.NewReader(r)}
+}
+
+// readLine returns the next line without its CR, LF or CRLF terminator. A
+// line left unterminated by the end of the stream is reported as io.EOF.
+func (er *eventReader) readLine() ([]byte, error) {
+	if !er.started {
+		er.started = true
+		if b, err := er.r.Peek(3); err == nil && bytes.Equal(b, []byte("\xEF\xBB\xBF")) {
+			er.r.Discard(3)
+		}
+	}
+
+	er.line = er.line[:0]
+	for {
+		c, err := er.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if er.skipLF {
+			er.skipLF = false
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case '\r':
+			er.skipLF = true
+			return er.line, nil
+		case '\n':
+			return er.line, nil
+		}
+		er.line = append(er.line, c)
+	}
+}
+
+// Next blocks until an event is dispatched. Incomplete events at the end of
+// the stream are discarded, as the specification requires.
+func (er *eventReader) Next() (Event, error) {
+	var data bytes.Buffer
+	name := ""
+	er.ownID = false
+
+	for {
+		line, err := er.readLine()
+		if err != nil {
+			return Event{}, err
+		}
+
+		if len(line) == 0 {
+			if data.Len() == 0 {
+				name = ""
+				er.ownID = false
+				continue
+			}
+			raw := data.Bytes()
+			raw = raw[:len(raw)-1]
+
+			if name == "" {
+				name = "message"
+			}
+			return newEvent(name, er.lastID, string(raw)), nil
+		}
+
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			if len(value) > 0 && value[0] == ' ' {
+				value = value[1:]
+			}
+		}
+
+		switch string(field) {
+		case "event":
+			name = string(value)
+		case "data":
+			data.Write(value)
+			data.WriteByte('\n')
+		case "id":
+			if bytes.IndexByte(value, 0) < 0 {
+				er.lastID = string(value)
+				er.ownID = true
+			}
+		case "retry":
+			if isDigits(value) {
+				if ms, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+					er.retry = time.Duration(ms) * time.Millisecond
+				}
+			}
+		}
+	}
+}
+
+func isDigits(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// EventStream is a single connection to an event endpoint. Unlike a
+// Subscription it does not reconnect; once the connection ends the Events
+// channel is closed and Err reports why.
+type EventStream struct {
+	events chan Event
+	body   io.Closer
+	done   chan struct{}
+	quit   chan struct{}
+	once   sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// OpenEventStream connects to a text/event-stream URL.
+func OpenEventStream(rawurl string) (*EventStream, error) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("got response status code %d", resp.StatusCode)
+	}
+
+	es := &EventStream{
+		events: make(chan Event),
+		body:   resp.Body,
+		done:   make(chan struct{}),
+		quit:   make(chan struct{}),
+	}
+	go es.loop(newEventReader(resp.Body))
+	return es, nil
+}
+
+// Events returns the channel events are delivered on.
+func (es *EventStream) Events() <-chan Event {
+	return es.events
+}
+
+// Err returns the error that ended the stream, nil while it is open or when
+// it was closed with Close.
+func (es *EventStream) Err() error {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	return es.err
+}
+
+// Close releases the connection and waits for the reading goroutine to exit.
+func (es *EventStream) Close() error {
+	var err error
+	es.once.Do(func() {
+		close(es.quit)
+		err = es.body.Close()
+	})
+	<-es.done
+	return err
+}
+
+func (es *EventStream) loop(reader *eventReader) {
+	defer close(es.done)
+	defer close(es.events)
+	defer es.body.Close()
+
+	for {
+		ev, err := reader.Next()
+		if err != nil {
+			select {
+			case <-es.quit:
+			default:
+				es.mu.Lock()
+				es.err = err
+				es.mu.Unlock()
+			}
+			return
+		}
+
+		select {
+		case es.events <- ev:
+		case <-es.quit:
+			return
+		}
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, stream string) ([]Event, *eventReader) {
+	t.Helper()
+	er := newEventReader(strings.NewReader(stream))
+	var events []Event
+	for {
+		ev, err := er.Next()
+		if err == io.EOF {
+			return events, er
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		events = append(events, ev)
+	}
+}
+
+func TestEventReader(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []Event
+	}{
+		{
+			name:   "json object",
+			stream: "id: 1\nevent: update\ndata: {\"a\":1}\n\n",
+			want:   []Event{{Name: "update", ID: "1", Raw: `{"a":1}`, Data: map[string]interface{}{"a": 1.0}}},
+		},
+		{
+			name:   "multi-line data",
+			stream: "data: first\ndata:second\ndata\n\n",
+			want:   []Event{{Name: "message", Raw: "first\nsecond\n"}},
+		},
+		{
+			name:   "crlf and cr line endings",
+			stream: "data: a\r\ndata: b\r\rdata: c\r\n\r\n",
+			want:   []Event{{Name: "message", Raw: "a\nb"}, {Name: "message", Raw: "c"}},
+		},
+		{
+			name:   "byte order mark and comments",
+			stream: "\xEF\xBB\xBF: hello\ndata: x\n\n",
+			want:   []Event{{Name: "message", Raw: "x"}},
+		},
+		{
+			name:   "id carries over and ignores NUL",
+			stream: "id: 7\ndata: a\n\nid: 8\x00\ndata: b\n\n",
+			want:   []Event{{Name: "message", ID: "7", Raw: "a"}, {Name: "message", ID: "7", Raw: "b"}},
+		},
+		{
+			name:   "empty data is not dispatched",
+			stream: "event: ping\n\ndata: a\n\n",
+			want:   []Event{{Name: "message", Raw: "a"}},
+		},
+		{
+			name:   "incomplete event is discarded",
+			stream: "data: a\n\ndata: b\n",
+			want:   []Event{{Name: "message", Raw: "a"}},
+		},
+		{
+			name:   "only one leading space is removed",
+			stream: "data:  two\n\n",
+			want:   []Event{{Name: "message", Raw: " two"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := readAll(t, tt.stream)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEventReaderRetry(t *testing.T) {
+	_, er := readAll(t, "retry: 1500\nretry: 2x\n\n")
+	if er.retry != 1500*time.Millisecond {
+		t.Errorf("got retry %v, want 1.5s", er.retry)
+	}
+}
+
+func TestEventStreamClose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "data: {\"a\":1}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	es, err := OpenEventStream(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := <-es.Events(); ev.Data["a"] != 1.0 {
+		t.Errorf("unexpected event %v", ev)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		es.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not release the stream")
+	}
+	if _, ok := <-es.Events(); ok {
+		t.Error("events channel left open")
+	}
+	if es.Err() != nil {
+		t.Errorf("unexpected error after Close: %v", es.Err())
+	}
+}
+
+func FuzzEventReader(f *testing.F) {
+	f.Add("id: 1\nevent: update\ndata: {\"a\":1}\n\n")
+	f.Add("data: a\r\ndata: b\r\rretry: 10\n\n")
+	f.Add("\xEF\xBB\xBF:comment\ndata\n\n")
+
+	f.Fuzz(func(t *testing.T, stream string) {
+		er := newEventReader(strings.NewReader(stream))
+		terminators := strings.Count(stream, "\n") + strings.Count(stream, "\r")
+		for i := 0; ; i++ {
+			ev, err := er.Next()
+			if err != nil {
+				if err != io.EOF {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if i >= terminators {
+				t.Fatalf("more events than line terminators")
+			}
+			if strings.ContainsRune(ev.Raw, '\r') {
+				t.Fatalf("data contains CR: %q", ev.Raw)
+			}
+			if strings.ContainsRune(ev.ID, 0) {
+				t.Fatalf("event ID contains NUL: %q", ev.ID)
+			}
+			if ev.Name == "" {
+				t.Fatal("event has no name")
+			}
+		}
+	})
+}
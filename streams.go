@@ -0,0 +1,273 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ActivityStream is a stream as stored on the ledger. The node's own fields,
+// those starting with _ or $, are kept apart from the state contracts write.
+type ActivityStream struct {
+	ID       string
+	Revision string
+	Name     string
+	// Metadata holds the $ and _ prefixed fields other than _id and _rev,
+	// such as $stream.
+	Metadata map[string]json.RawMessage
+	// State is the stream's data as a JSON object.
+	State json.RawMessage
+}
+
+// StreamResult is one stream of a GetStreams call. Err is set when the
+// stream is missing or its state could not be decoded.
+type StreamResult[T any] struct {
+	ID     string
+	Stream ActivityStream
+	State  T
+	Err    error
+}
+
+// ErrStreamNotFound is returned for streams the node did not return.
+var ErrStreamNotFound = errors.New("stream not found")
+
+// ParseActivityStream splits a stream document into an ActivityStream.
+func ParseActivityStream(doc map[string]json.RawMessage) (ActivityStream, error) {
+	s := ActivityStream{
+		ID:       stringField(doc, "_id"),
+		Revision: stringField(doc, "_rev"),
+		Name:     stringField(doc, "name"),
+		Metadata: make(map[string]json.RawMessage),
+	}
+
+	state := make(map[string]json.RawMessage)
+	for key, value := range doc {
+		switch {
+		case key == "_id" || key == "_rev":
+		case strings.HasPrefix(key, "_") || strings.HasPrefix(key, "$"):
+			s.Metadata[key] = value
+		default:
+			state[key] = value
+		}
+	}
+	if s.Name == "" {
+		var meta map[string]json.RawMessage
+		if json.Unmarshal(s.Metadata["$stream"], &meta) == nil {
+			s.Name = stringField(meta, "name")
+		}
+	}
+
+	var err error
+	s.State, err = json.Marshal(state)
+	return s, err
+}
+
+// DecodeState unmarshals a stream's state into T.
+func DecodeState[T any](s ActivityStream) (T, error) {
+	var v T
+	if err := json.Unmarshal(s.State, &v); err != nil {
+		return v, fmt.Errorf("stream %s: %w", s.ID, err)
+	}
+	return v, nil
+}
+
+// GetStream fetches a stream and decodes its state into T.
+// host:http://ip:port
+func GetStream[T any](ctx context.Context, host string, id string) (ActivityStream, T, error) {
+	var v T
+	doc, err := fetchStream(ctx, http.DefaultClient, host, id)
+	if err != nil {
+		return ActivityStream{}, v, err
+	}
+	s, err := ParseActivityStream(doc)
+	if err != nil {
+		return ActivityStream{}, v, err
+	}
+	v, err = DecodeState[T](s)
+	return s, v, err
+}
+
+// GetStreams fetches several streams in one request and decodes each state
+// into T. The results follow the order of ids; a stream that is missing or
+// fails to decode has its own Err, while the returned error is for the
+// request as a whole.
+func GetStreams[T any](ctx context.Context, host string, ids []string) ([]StreamResult[T], error) {
+	streams, err := fetchStreams(ctx, http.DefaultClient, host, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]StreamResult[T], len(ids))
+	for i, id := range ids {
+		results[i].ID = id
+		s, ok := streams[id]
+		if !ok {
+			results[i].Err = fmt.Errorf("stream %s: %w", id, ErrStreamNotFound)
+			continue
+		}
+		results[i].Stream = s
+		results[i].State, results[i].Err = DecodeState[T](s)
+	}
+	return results, nil
+}
+
+// fetchStreams posts ids to /api/stream and returns the streams found, by ID.
+func fetchStreams(ctx context.Context, client *http.Client, host string, ids []string) (map[string]ActivityStream, error) {
+	var body struct {
+		Streams []map[string]json.RawMessage `json:"streams"`
+	}
+	if err := postJSON(ctx, client, host, "/api/stream", ids, &body); err != nil {
+		return nil, err
+	}
+
+	streams := make(map[string]ActivityStream, len(body.Streams))
+	for _, doc := range body.Streams {
+		s, err := ParseActivityStream(doc)
+		if err != nil {
+			return nil, err
+		}
+		streams[s.ID] = s
+	}
+	return streams, nil
+}
+
+// BulkOptions configures GetStreamsBulk.
+type BulkOptions struct {
+	// ChunkSize is the number of IDs sent per request, 500 when zero.
+	ChunkSize int
+	// Concurrency is the number of requests in flight, 4 when zero.
+	Concurrency int
+	// Client makes the requests, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// BulkResult holds the streams found by GetStreamsBulk, by ID, and the
+// requested IDs that no node returned.
+type BulkResult struct {
+	Streams map[string]ActivityStream
+	Missing []string
+}
+
+// GetStreamsBulk fetches any number of streams by splitting ids into chunks
+// and requesting them concurrently, spreading the chunks across hosts. A
+// chunk that fails on its node is retried on the others before the whole
+// fetch fails.
+func GetStreamsBulk(ctx context.Context, hosts []string, ids []string, opts BulkOptions) (BulkResult, error) {
+	if len(hosts) == 0 {
+		return BulkResult{}, ErrNoNodes
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = 500
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 4
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	unique := make([]string, 0, len(ids))
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		firstErr error
+		sem      = make(chan struct{}, opts.Concurrency)
+		result   = BulkResult{Streams: make(map[string]ActivityStream, len(unique))}
+	)
+
+	for n, start := 0, 0; start < len(unique); n, start = n+1, start+opts.ChunkSize {
+		end := start + opts.ChunkSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+		chunk := unique[start:end]
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(n int, chunk []string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			var streams map[string]ActivityStream
+			var err error
+			for i := range hosts {
+				host := hosts[(n+i)%len(hosts)]
+				if streams, err = fetchStreams(ctx, opts.Client, host, chunk); err == nil || ctx.Err() != nil {
+					break
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				return
+			}
+			for id, s := range streams {
+				result.Streams[id] = s
+			}
+		}(n, chunk)
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	if firstErr != nil {
+		return BulkResult{}, firstErr
+	}
+
+	for _, id := range unique {
+		if _, ok := result.Streams[id]; !ok {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,233 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Submission tracks a transaction sent with SubmitAsync until it commits.
+type Submission struct {
+	accepted chan struct{}
+	done     chan struct{}
+
+	mu   sync.Mutex
+	resp Response
+	err  error
+}
+
+/*
+SubmitAsync sends a transaction without waiting for it and returns a handle
+which resolves once the commit is confirmed, either by an activity event
+carrying the transaction's UMID on one of the streams it touches, or by the
+node returning the transaction's record. The streams are subscribed to
+before the transaction is sent so no event is missed. Cancelling ctx stops
+tracking the transaction, not the transaction itself.
+host:http://ip:port
+*/
+func SubmitAsync(ctx context.Context, transaction Transaction, host string) *Submission {
+	s := &Submission{accepted: make(chan struct{}), done: make(chan struct{})}
+	go s.run(ctx, transaction, host)
+	return s
+}
+
+// Accepted is closed once the node has answered, successfully or not.
+func (s *Submission) Accepted() <-chan struct{} {
+	return s.accepted
+}
+
+// Done is closed once the commit is confirmed or the submission failed.
+func (s *Submission) Done() <-chan struct{} {
+	return s.done
+}
+
+// UMID returns the transaction's UMID, empty until the node has accepted it.
+func (s *Submission) UMID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resp.UMID
+}
+
+// Summary returns the node's summary of the transaction.
+func (s *Submission) Summary() Summary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resp.Summary
+}
+
+// Response returns the node's full answer to the transaction.
+func (s *Submission) Response() Response {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resp
+}
+
+// Err returns why the submission failed, nil while it is pending and once
+// the commit is confirmed.
+func (s *Submission) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Wait blocks until the submission is done or ctx ends, then returns the
+// node's response and the submission's error.
+func (s *Submission) Wait(ctx context.Context) (Response, error) {
+	select {
+	case <-s.done:
+		return s.Response(), s.Err()
+	case <-ctx.Done():
+		return s.Response(), ctx.Err()
+	}
+}
+
+func (s *Submission) run(ctx context.Context, transaction Transaction, host string) {
+	acceptOnce := sync.Once{}
+	accept := func() { acceptOnce.Do(func() { close(s.accepted) }) }
+	defer close(s.done)
+	defer accept()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	umids := make(chan string, 16)
+	for _, stream := range affectedStreams(transaction) {
+		es, err := SubscribeStream(host, stream)
+		if err != nil {
+			// the record is polled for anyway
+			continue
+		}
+		defer es.Close()
+		go forwardUMIDs(es, umids, stop)
+	}
+
+	type result struct {
+		resp Response
+		err  error
+	}
+	sent := make(chan result, 1)
+	go func() {
+		resp, err := SendTransaction(transaction, host)
+		sent <- result{resp, err}
+	}()
+
+	var umid string
+	seen := make(map[string]bool)
+	for umid == "" {
+		select {
+		case r := <-sent:
+			s.mu.Lock()
+			s.resp, s.err = r.resp, r.err
+			s.mu.Unlock()
+			accept()
+			if r.err != nil {
+				return
+			}
+			umid = r.resp.UMID
+			if umid == "" {
+				s.fail(errors.New("node returned no UMID"))
+				return
+			}
+			if seen[umid] {
+				return
+			}
+		case id := <-umids:
+			seen[id] = true
+		case <-ctx.Done():
+			s.fail(ctx.Err())
+			return
+		}
+	}
+
+	wait := 250 * time.Millisecond
+	poll := time.NewTimer(0)
+	defer poll.Stop()
+	for {
+		select {
+		case id := <-umids:
+			if id == umid {
+				return
+			}
+		case <-poll.C:
+			if _, err := fetchTransaction(ctx, host, umid); err == nil {
+				return
+			}
+			poll.Reset(wait)
+			if wait *= 2; wait > 5*time.Second {
+				wait = 5 * time.Second
+			}
+		case <-ctx.Done():
+			s.fail(ctx.Err())
+			return
+		}
+	}
+}
+
+func (s *Submission) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// forwardUMIDs sends the UMID of every activity event on es until stop closes.
+func forwardUMIDs(es *EventStream, umids chan<- string, stop <-chan struct{}) {
+	for ev := range es.Events() {
+		a, err := ParseActivityEvent(ev)
+		if err != nil || a.UMID == "" {
+			continue
+		}
+		select {
+		case umids <- a.UMID:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// affectedStreams lists the streams a transaction reads or writes. Inputs
+// of a self signed transaction name new identities rather than streams.
+func affectedStreams(transaction Transaction) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(entries map[string]interface{}) {
+		for key, value := range entries {
+			id := key
+			if fields, ok := value.(map[string]interface{}); ok {
+				if stream, ok := fields["$stream"].(string); ok && stream != "" {
+					id = stream
+				}
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if !transaction.SelfSign {
+		add(transaction.TxObject.Input)
+	}
+	add(transaction.TxObject.Output)
+	return ids
+}
@@ -0,0 +1,333 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ConnState is the connection state of a Subscription.
+type ConnState int
+
+// Subscription connection states
+const (
+	Connecting ConnState = iota
+	Connected
+	Disconnected
+	Closed
+)
+
+var connStates = [...]string{
+	"connecting",
+	"connected",
+	"disconnected",
+	"closed",
+}
+
+func (s ConnState) String() string { return connStates[s] }
+
+// SubscribeOptions configures a Subscription. The zero value is usable.
+type SubscribeOptions struct {
+	// Client makes the requests, http.DefaultClient when nil.
+	Client *http.Client
+	// LastEventID resumes the subscription after this event.
+	LastEventID string
+	// RetryDelay is the first reconnection delay, 1s when zero. A retry
+	// field sent by the node replaces it.
+	RetryDelay time.Duration
+	// MaxRetryDelay caps the exponential backoff, 30s when zero.
+	MaxRetryDelay time.Duration
+	// OnStateChange is called from the subscription goroutine on every
+	// state change. err is the reason for a Disconnected state.
+	OnStateChange func(state ConnState, err error)
+	// Checkpoints resumes the subscription after the last event passed to
+	// Ack, taking precedence over LastEventID. Events are delivered at least
+	// once; replayed IDs already seen are dropped.
+	Checkpoints CheckpointStore
+	// CheckpointKey names the subscription in Checkpoints, the topic when empty.
+	CheckpointKey string
+	// Buffer is the number of events held for a slow consumer. When zero
+	// every event waits for the consumer to receive it.
+	Buffer int
+	// Overflow decides what happens to new events while Buffer is full.
+	Overflow OverflowPolicy
+	// SpillDir is where OverflowSpill writes events, os.TempDir() when empty.
+	SpillDir string
+}
+
+// recentIDSize is how many event IDs a subscription remembers for deduplication.
+const recentIDSize = 1024
+
+// Subscription is a server sent event subscription that reconnects with
+// backoff when its connection drops, resuming with Last-Event-ID.
+type Subscription struct {
+	url    string
+	opts   SubscribeOptions
+	events chan Event
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	queue  *eventQueue
+
+	mu     sync.Mutex
+	lastID string
+	delay  time.Duration
+	seen   *recentIDs
+}
+
+// NewSubscription starts a reconnecting subscription to topic on the node
+// at host, host:http://ip:port
+func NewSubscription(host string, topic Topic, opts SubscribeOptions) (*Subscription, error) {
+	rawurl, err := topic.URL(host)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = 30 * time.Second
+	}
+	if opts.CheckpointKey == "" {
+		opts.CheckpointKey = string(topic)
+	}
+
+	seen := newRecentIDs(recentIDSize)
+	if opts.Checkpoints != nil {
+		id, err := opts.Checkpoints.Load(opts.CheckpointKey)
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			opts.LastEventID = id
+			seen.Add(id)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Subscription{
+		url:    rawurl,
+		opts:   opts,
+		events: make(chan Event),
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		lastID: opts.LastEventID,
+		delay:  opts.RetryDelay,
+		seen:   seen,
+	}
+	if opts.Buffer > 0 {
+		s.queue = newEventQueue(opts.Buffer, opts.Overflow, opts.SpillDir)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.run()
+	}()
+	if s.queue != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.drain()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		if s.queue != nil {
+			s.queue.close()
+		}
+		close(s.events)
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// Events returns the channel events are delivered on. It is closed once the
+// subscription is closed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// LastEventID returns the ID of the last event received, which is sent as
+// Last-Event-ID when reconnecting.
+func (s *Subscription) LastEventID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastID
+}
+
+// Ack records ev as processed in the subscription's CheckpointStore, so a
+// restarted subscription resumes after it. Without a store it does nothing.
+func (s *Subscription) Ack(ev Event) error {
+	if s.opts.Checkpoints == nil || ev.ID == "" {
+		return nil
+	}
+	return s.opts.Checkpoints.Save(s.opts.CheckpointKey, ev.ID)
+}
+
+// Close stops the subscription and waits for its connection to be released.
+func (s *Subscription) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+// Stats returns the subscription's buffering counters.
+func (s *Subscription) Stats() SubscriptionStats {
+	if s.queue == nil {
+		return SubscriptionStats{}
+	}
+	return s.queue.stats()
+}
+
+func (s *Subscription) run() {
+	attempt := 0
+	for {
+		s.setState(Connecting, nil)
+		connected, err := s.connect()
+		if s.ctx.Err() != nil {
+			s.setState(Closed, nil)
+			return
+		}
+		if connected {
+			attempt = 0
+		}
+		s.setState(Disconnected, err)
+
+		select {
+		case <-time.After(s.backoff(attempt)):
+			attempt++
+		case <-s.ctx.Done():
+			s.setState(Closed, nil)
+			return
+		}
+	}
+}
+
+// connect holds one connection open, delivering its events until it fails.
+func (s *Subscription) connect() (bool, error) {
+	req, err := http.NewRequestWithContext(s.ctx, "GET", s.url, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if id := s.LastEventID(); id != "" {
+		req.Header.Set("Last-Event-ID", id)
+	}
+
+	resp, err := s.opts.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("subscription: got response status code %d", resp.StatusCode)
+	}
+	s.setState(Connected, nil)
+
+	reader := newEventReader(resp.Body)
+	reader.lastID = s.LastEventID()
+	for {
+		ev, err := reader.Next()
+		if reader.retry > 0 {
+			s.mu.Lock()
+			s.delay = reader.retry
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return true, err
+		}
+
+		s.mu.Lock()
+		s.lastID = reader.lastID
+		fresh := !reader.ownID || ev.ID == "" || s.seen.Add(ev.ID)
+		s.mu.Unlock()
+		if !fresh {
+			continue
+		}
+
+		if !s.deliver(ev) {
+			return true, s.ctx.Err()
+		}
+	}
+}
+
+// deliver hands ev to the consumer, or to the buffer when there is one.
+func (s *Subscription) deliver(ev Event) bool {
+	if s.queue != nil {
+		return s.queue.push(s.ctx, ev)
+	}
+	select {
+	case s.events <- ev:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// drain passes buffered events to the consumer.
+func (s *Subscription) drain() {
+	for {
+		ev, ok := s.queue.pop(s.ctx)
+		if !ok {
+			return
+		}
+		select {
+		case s.events <- ev:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// backoff doubles the reconnection delay for each failed attempt in a row.
+func (s *Subscription) backoff(attempt int) time.Duration {
+	s.mu.Lock()
+	delay := s.delay
+	s.mu.Unlock()
+
+	for i := 0; i < attempt && delay < s.opts.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.opts.MaxRetryDelay {
+		delay = s.opts.MaxRetryDelay
+	}
+	return delay
+}
+
+func (s *Subscription) setState(state ConnState, err error) {
+	if s.opts.OnStateChange != nil {
+		s.opts.OnStateChange(state, err)
+	}
+}
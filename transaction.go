@@ -24,9 +24,11 @@ package sdk
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rsa"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 
@@ -40,12 +42,16 @@ type Encryption int
 const (
 	RSA = iota
 	EC
+	ED25519
+	P256
 )
 
-//Encrptype stores types of Encryption available
-var Encrptype = [...]string{
+//Encrptype stores types of Encryption available. Further types are added with RegisterEncryption.
+var Encrptype = []string{
 	"rsa",
 	"secp256k1",
+	"ed25519",
+	"secp256r1",
 }
 
 //Transaction elements
@@ -101,12 +107,15 @@ type TransactionReq struct {
 	KeyName        string
 	RsaKey         *rsa.PrivateKey
 	EcKey          *bitecdsa.PrivateKey
+	// PrivateKey signs for key types other than RSA and EC, eg ed25519.PrivateKey.
+	PrivateKey     crypto.PrivateKey
 	KeyType        string
 }
 
 func (encrp Encryption) String() string { return Encrptype[encrp] }
 
 //SendTransaction function sends complete transaction the activeledger network.
+//Errors the ledger reports in the summary are returned as a *TransactionError.
 //input: transaction,url
 func SendTransaction(transaction Transaction, url string) (Response, error) {
 	respObj := Response{}
@@ -141,7 +150,7 @@ func SendTransaction(transaction Transaction, url string) (Response, error) {
 	}
 
 	if len(respObj.Summary.Errors) > 0 {
-		return respObj, errors.New("Activeledger error, see response.Summary.Errors")
+		return respObj, &TransactionError{UMID: respObj.UMID, Errors: ClassifyErrors(respObj.Summary.Errors)}
 	}
 
 	return respObj, nil
@@ -149,27 +158,62 @@ func SendTransaction(transaction Transaction, url string) (Response, error) {
 
 // CreateTransaction function create a transaction object and returns it to User. 
 // This function is for when user need to add multiple signature to the sigs object.
+// It returns nil when the transaction cannot be signed, BuildTransaction reports why.
 func CreateTransaction(txReq TransactionReq) *Transaction {
+	tx, err := BuildTransaction(txReq)
+	if err != nil {
+		return nil
+	}
+	return tx
+}
+
+// BuildTransaction creates and signs a transaction like CreateTransaction,
+// returning an error when the key is missing or does not match KeyType.
+func BuildTransaction(txReq TransactionReq) (*Transaction, error) {
 	temp := make(map[string]interface{})
 	sig := make(map[string]interface{})
 
-	tempMap := make(map[string]interface{})
-	tempMap[txReq.KeyName] = nil
-
-	m := txReq.TxObject.Input[txReq.StreamID].(map[string]interface{})
+	m, ok := txReq.TxObject.Input[txReq.StreamID].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sdk: no input for stream %q", txReq.StreamID)
+	}
 	m["$stream"] = txReq.StreamID
 	temp[txReq.KeyName] = m
 
 	txReq.TxObject.Input = temp
 
-	txObjectByte, _ := json.Marshal(txReq.TxObject)
+	txObjectByte, err := json.Marshal(txReq.TxObject)
+	if err != nil {
+		return nil, err
+	}
 	if txReq.KeyType == Encrptype[RSA] {
 
-		sign, _ := RsaSign(*txReq.RsaKey, txObjectByte)
+		if txReq.RsaKey == nil {
+			return nil, errors.New("sdk: RsaKey is nil")
+		}
+		sign, err := RsaSign(*txReq.RsaKey, txObjectByte)
+		if err != nil {
+			return nil, err
+		}
+		sig[txReq.StreamID] = sign
+
+	} else if encrp, ok := EncryptionByName(txReq.KeyType); ok && encrp != EC {
+
+		alg, err := encrp.Algorithm()
+		if err != nil {
+			return nil, err
+		}
+		sign, err := alg.Sign(txReq.PrivateKey, txObjectByte)
+		if err != nil {
+			return nil, err
+		}
 		sig[txReq.StreamID] = sign
 
 	} else {
 
+		if txReq.EcKey == nil {
+			return nil, errors.New("sdk: EcKey is nil")
+		}
 		sign := EcdsaSign(txReq.EcKey, string(txObjectByte))
 		sig[txReq.StreamID] = sign
 	}
@@ -179,15 +223,16 @@ func CreateTransaction(txReq TransactionReq) *Transaction {
 	tx.Signature = sig
 	tx.SelfSign = txReq.SelfSign
 	tx.Territoriality = txReq.Territoriality
-	//st, _ := json.Marshal(tx)
-	return tx
-
+	return tx, nil
 }
 
 //CreateAndSendTransaction  function creates and sends the transaction to acitveledger. Send the Response object back to user
 func CreateAndSendTransaction(txReq TransactionReq) (Response, error) {
 
-	var tx = CreateTransaction(txReq)
+	tx, err := BuildTransaction(txReq)
+	if err != nil {
+		return Response{}, err
+	}
 	return SendTransaction(*tx, GetUrl())
 
 }
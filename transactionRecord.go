@@ -0,0 +1,208 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ErrTransactionNotFound matches every TransactionNotFoundError with errors.Is.
+var ErrTransactionNotFound = errors.New("transaction not found")
+
+// TransactionNotFoundError is returned when a node has no record of a
+// transaction, as opposed to failing to answer.
+type TransactionNotFoundError struct {
+	Host string
+	UMID string
+}
+
+func (e *TransactionNotFoundError) Error() string {
+	return fmt.Sprintf("%s: transaction %s not found", e.Host, e.UMID)
+}
+
+func (e *TransactionNotFoundError) Is(target error) bool {
+	return target == ErrTransactionNotFound
+}
+
+// TransactionRevs holds the stream revisions a transaction read and wrote.
+type TransactionRevs struct {
+	Input  map[string]string `json:"$i,omitempty"`
+	Output map[string]string `json:"$o,omitempty"`
+}
+
+// TransactionRecord is a committed transaction as the ledger stores it.
+type TransactionRecord struct {
+	UMID string
+	Tx   TxObject
+	// RawTx is $tx exactly as the node returned it, the bytes its
+	// signatures are checked over.
+	RawTx          json.RawMessage
+	Signatures     map[string]string
+	SelfSign       bool
+	Territoriality string
+	Revs           TransactionRevs
+	// Datetime is when the node processed the transaction, zero when the
+	// record does not say.
+	Datetime time.Time
+	// Extra holds the record's other fields, and any of the above the
+	// node sent in an unexpected form.
+	Extra map[string]json.RawMessage
+}
+
+// UnmarshalJSON reads a record as returned by /api/tx/{umid}.
+func (r *TransactionRecord) UnmarshalJSON(b []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	*r = TransactionRecord{Extra: make(map[string]json.RawMessage)}
+
+	for key, raw := range fields {
+		var err error
+		switch key {
+		case "$umid":
+			err = json.Unmarshal(raw, &r.UMID)
+		case "$tx":
+			r.RawTx = raw
+			err = json.Unmarshal(raw, &r.Tx)
+		case "$sigs":
+			err = json.Unmarshal(raw, &r.Signatures)
+		case "$selfsign":
+			err = json.Unmarshal(raw, &r.SelfSign)
+		case "$territoriality":
+			err = json.Unmarshal(raw, &r.Territoriality)
+		case "$revs":
+			err = json.Unmarshal(raw, &r.Revs)
+		case "$datetime":
+			if r.Datetime = ledgerTime(raw); r.Datetime.IsZero() {
+				err = errors.New("unknown time format")
+			}
+		default:
+			err = errors.New("unknown field")
+		}
+		if err != nil {
+			r.Extra[key] = raw
+		}
+	}
+
+	if r.Datetime.IsZero() {
+		var tx map[string]json.RawMessage
+		if json.Unmarshal(r.RawTx, &tx) == nil {
+			r.Datetime = ledgerTime(tx["$datetime"])
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes the record back in the node's form.
+func (r TransactionRecord) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(r.Extra)+8)
+	for key, raw := range r.Extra {
+		fields[key] = raw
+	}
+	fields["$umid"] = r.UMID
+	if r.RawTx != nil {
+		fields["$tx"] = r.RawTx
+	} else {
+		fields["$tx"] = r.Tx
+	}
+	fields["$sigs"] = r.Signatures
+	fields["$selfsign"] = r.SelfSign
+	if r.Territoriality != "" {
+		fields["$territoriality"] = r.Territoriality
+	}
+	if r.Revs.Input != nil || r.Revs.Output != nil {
+		fields["$revs"] = r.Revs
+	}
+	if !r.Datetime.IsZero() {
+		fields["$datetime"] = r.Datetime.UTC().Format(time.RFC3339Nano)
+	}
+	return json.Marshal(fields)
+}
+
+/*
+GetTransaction fetches a committed transaction. A transaction the node has
+no record of gives a *TransactionNotFoundError.
+host:http://ip:port
+*/
+func GetTransaction(ctx context.Context, host string, umid string) (TransactionRecord, error) {
+	record, err := fetchTransaction(ctx, host, umid)
+	if err != nil {
+		return TransactionRecord{}, err
+	}
+	return *record, nil
+}
+
+// WaitForTransaction polls the node set with SetUrl until the transaction
+// umid has been committed, waiting longer between each poll up to 5s. It
+// gives up with ctx's error once ctx is done, and returns at once on errors
+// other than the transaction not being found yet.
+func WaitForTransaction(ctx context.Context, umid string) (TransactionRecord, error) {
+	wait := 250 * time.Millisecond
+	for {
+		record, err := GetTransaction(ctx, GetUrl(), umid)
+		if !errors.Is(err, ErrTransactionNotFound) {
+			return record, err
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return TransactionRecord{}, ctx.Err()
+		}
+		if wait *= 2; wait > 5*time.Second {
+			wait = 5 * time.Second
+		}
+	}
+}
+
+// fetchTransaction reads the record of a transaction. Records of committed
+// transactions never change, so they are cached.
+func fetchTransaction(ctx context.Context, host string, umid string) (*TransactionRecord, error) {
+	if record, ok := txCache.Get(umid); ok {
+		return record, nil
+	}
+
+	var record *TransactionRecord
+	err := getJSON(ctx, http.DefaultClient, host, "/api/tx/"+url.PathEscape(umid), nil, &record)
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return nil, &TransactionNotFoundError{Host: host, UMID: umid}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// some nodes answer an unknown UMID with an empty or error body
+	if record == nil || record.RawTx == nil {
+		return nil, &TransactionNotFoundError{Host: host, UMID: umid}
+	}
+
+	txCache.Put(umid, record)
+	return record, nil
+}
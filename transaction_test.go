@@ -0,0 +1,66 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import "testing"
+
+func TestCreateTransactionInvalid(t *testing.T) {
+	edKey, err := Ed25519KeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := P256KeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := func() map[string]interface{} {
+		return map[string]interface{}{"s1": map[string]interface{}{}}
+	}
+	tests := []struct {
+		name string
+		req  TransactionReq
+	}{
+		{"no input for stream", TransactionReq{StreamID: "s2", KeyType: Encrptype[ED25519], PrivateKey: edKey}},
+		{"missing rsa key", TransactionReq{StreamID: "s1", KeyType: Encrptype[RSA]}},
+		{"missing ec key", TransactionReq{StreamID: "s1", KeyType: Encrptype[EC]}},
+		{"mismatched key", TransactionReq{StreamID: "s1", KeyType: Encrptype[ED25519], PrivateKey: p256Key}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.TxObject.Input = input()
+			if _, err := BuildTransaction(tt.req); err == nil {
+				t.Error("BuildTransaction: expected an error")
+			}
+			if tx := CreateTransaction(tt.req); tx != nil {
+				t.Errorf("CreateTransaction = %+v, want nil", tx)
+			}
+		})
+	}
+
+	req := TransactionReq{StreamID: "s1", KeyName: "s1", KeyType: Encrptype[ED25519], PrivateKey: edKey}
+	req.TxObject.Input = input()
+	if tx := CreateTransaction(req); tx == nil || tx.Signature["s1"] == nil {
+		t.Errorf("CreateTransaction with a valid key = %+v, want a signed transaction", tx)
+	}
+}
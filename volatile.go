@@ -0,0 +1,253 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrVolatileConflict is returned by Volatile.Update when other writers kept
+// changing the volatile area for every attempt allowed by its RetryPolicy,
+// or when the area no longer held the new value when read back after
+// writing it.
+var ErrVolatileConflict = errors.New("volatile: concurrent modification")
+
+// RetryPolicy controls how often a conflicting update is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of tries, 5 when zero.
+	MaxAttempts int
+	// Backoff is the wait after the first conflict, doubled after each
+	// further one, 50ms when zero.
+	Backoff time.Duration
+}
+
+// VolatileOptions configures a Volatile handle.
+type VolatileOptions struct {
+	Retry RetryPolicy
+	// Client makes the requests, http.DefaultClient when nil.
+	Client *http.Client
+}
+
+// Volatile is a typed handle on a stream's volatile area.
+//
+// The node has no conditional write for volatile data, so conflict checks
+// are best effort. Updates to the same stream made through this package are
+// serialised. Update checks that the area's revision, or a hash of its
+// content when the node sends no revision, has not changed between reading
+// it and writing the new value, and reads it back after writing. A write
+// from elsewhere landing after the check but before ours is still lost
+// without an error; one landing after ours is reported as a conflict.
+type Volatile[T any] struct {
+	host string
+	id   string
+	opts VolatileOptions
+	lock *sync.Mutex
+}
+
+// volatileLocks holds one lock per host and stream, shared by every handle.
+var volatileLocks sync.Map
+
+// NewVolatile returns a handle on the volatile area of stream id on the node
+// at host, host:http://ip:port
+func NewVolatile[T any](host string, id string, opts VolatileOptions) *Volatile[T] {
+	if opts.Retry.MaxAttempts <= 0 {
+		opts.Retry.MaxAttempts = 5
+	}
+	if opts.Retry.Backoff <= 0 {
+		opts.Retry.Backoff = 50 * time.Millisecond
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	lock, _ := volatileLocks.LoadOrStore(host+"\x00"+id, new(sync.Mutex))
+	return &Volatile[T]{host: host, id: id, opts: opts, lock: lock.(*sync.Mutex)}
+}
+
+// Get reads the volatile area. An empty area decodes as the zero T.
+func (v *Volatile[T]) Get(ctx context.Context) (T, error) {
+	value, _, _, err := v.read(ctx)
+	return value, err
+}
+
+// Set overwrites the volatile area with value.
+func (v *Volatile[T]) Set(ctx context.Context, value T) error {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	return writeVolatile(ctx, v.opts.Client, v.host, v.id, value)
+}
+
+// Update reads the volatile area, applies fn and writes the result, retrying
+// from a fresh read when another writer changed the area in the meantime.
+// An error from fn stops the update and is returned as is.
+func (v *Volatile[T]) Update(ctx context.Context, fn func(T) (T, error)) (T, error) {
+	var zero T
+	backoff := v.opts.Retry.Backoff
+
+	for attempt := 0; attempt < v.opts.Retry.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				return zero, ctx.Err()
+			}
+		}
+
+		next, ok, err := v.tryUpdate(ctx, fn)
+		if err != nil || ok {
+			return next, err
+		}
+	}
+	return zero, fmt.Errorf("stream %s: %w", v.id, ErrVolatileConflict)
+}
+
+// tryUpdate makes one attempt, reporting false when the area changed under it.
+func (v *Volatile[T]) tryUpdate(ctx context.Context, fn func(T) (T, error)) (T, bool, error) {
+	var zero T
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	current, version, _, err := v.read(ctx)
+	if err != nil {
+		return zero, false, err
+	}
+	next, err := fn(current)
+	if err != nil {
+		return zero, false, err
+	}
+
+	raw, err := json.Marshal(next)
+	if err != nil {
+		return zero, false, err
+	}
+	want, err := contentSum(raw)
+	if err != nil {
+		return zero, false, err
+	}
+
+	_, latest, _, err := v.read(ctx)
+	if err != nil {
+		return zero, false, err
+	}
+	if latest != version {
+		return zero, false, nil
+	}
+	if err := writeVolatile(ctx, v.opts.Client, v.host, v.id, next); err != nil {
+		return zero, false, err
+	}
+
+	// the value was written; if it is already gone another writer may have
+	// built on it, so report rather than apply fn again
+	_, _, written, err := v.read(ctx)
+	if err != nil {
+		return zero, false, err
+	}
+	if written != want {
+		return zero, false, fmt.Errorf("stream %s: overwritten after update: %w", v.id, ErrVolatileConflict)
+	}
+	return next, true, nil
+}
+
+// read returns the decoded area, its version and a hash of its content.
+func (v *Volatile[T]) read(ctx context.Context) (T, string, string, error) {
+	var value T
+	doc, err := readVolatile(ctx, v.opts.Client, v.host, v.id)
+	if err != nil {
+		return value, "", "", err
+	}
+
+	version := stringField(doc, "_rev")
+	content := make(map[string]json.RawMessage, len(doc))
+	for key, raw := range doc {
+		if key != "_id" && key != "_rev" {
+			content[key] = raw
+		}
+	}
+	b, err := json.Marshal(content)
+	if err != nil {
+		return value, "", "", err
+	}
+	sum, err := contentSum(b)
+	if err != nil {
+		return value, "", "", err
+	}
+	if version == "" {
+		version = sum
+	}
+
+	if len(content) > 0 {
+		if err := json.Unmarshal(b, &value); err != nil {
+			return value, "", "", fmt.Errorf("stream %s volatile: %w", v.id, err)
+		}
+	}
+	return value, version, sum, nil
+}
+
+// contentSum hashes a volatile value in a canonical form, so the value
+// written and the value read back compare equal however either is
+// formatted. An empty value hashes as an empty object.
+func contentSum(b []byte) (string, error) {
+	doc, err := decodeNumbers(b)
+	if err != nil {
+		return "", err
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	if c, err := json.Marshal(doc); err == nil {
+		b = c
+	}
+	return hashString(string(b)), nil
+}
+
+// readVolatile fetches a stream's volatile document, unwrapping the
+// "stream" envelope the node puts around it and decrypting it if needed.
+func readVolatile(ctx context.Context, client *http.Client, host string, id string) (map[string]json.RawMessage, error) {
+	var body map[string]json.RawMessage
+	if err := getJSON(ctx, client, host, "/api/stream/"+url.PathEscape(id)+"/volatile", nil, &body); err != nil {
+		return nil, err
+	}
+	doc, err := unwrapStream(body)
+	if err != nil {
+		return nil, err
+	}
+	return openVolatile(id, doc)
+}
+
+// writeVolatile replaces a stream's volatile document with value, encrypted
+// when SetVolatileEncryption is on.
+func writeVolatile(ctx context.Context, client *http.Client, host string, id string, value interface{}) error {
+	body, err := sealVolatile(id, value)
+	if err != nil {
+		return err
+	}
+	var resp json.RawMessage
+	return postJSON(ctx, client, host, "/api/stream/"+url.PathEscape(id)+"/volatile", body, &resp)
+}
@@ -0,0 +1,300 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/titanous/bitcoin-crypto/bitecdsa"
+)
+
+var (
+	// ErrVolatileTampered is returned when encrypted volatile data fails
+	// authentication: it was altered, or copied from another stream.
+	ErrVolatileTampered = errors.New("volatile: ciphertext failed authentication")
+	// ErrVolatileKeyNotFound is returned when volatile data was encrypted with
+	// a key that is not among those given to SetVolatileEncryption.
+	ErrVolatileKeyNotFound = errors.New("volatile: encryption key not found")
+)
+
+// encryptedField holds the envelope in an encrypted volatile document.
+const encryptedField = "$encrypted"
+
+// volatileKey is an AES-256 key derived from an identity key.
+type volatileKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+var volatileKeys struct {
+	sync.RWMutex
+	keys []volatileKey
+	// plaintext lets unencrypted values be read while encryption is on
+	plaintext bool
+}
+
+// volatileEnvelope is stored in place of the volatile value. The key ID lets
+// values written before a key rotation still be read.
+type volatileEnvelope struct {
+	KeyID string `json:"kid"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+/*
+SetVolatileEncryption turns on client side encryption of volatile data. Values
+written by SetActivityStreamVolatile and Volatile handles are sealed with
+AES-256-GCM under a key derived from the first identity key, and reads are
+opened with whichever of the keys wrote them, so keys can be rotated by
+putting the new key first. While it is on, reading a value that is not
+encrypted fails with ErrVolatileTampered, unless SetVolatilePlaintext allows
+it. Calling it with no keys turns encryption off.
+
+keys: RSAKey, ECKey, ED25519Key or P256Key
+*/
+func SetVolatileEncryption(keys ...crypto.PrivateKey) error {
+	derived := make([]volatileKey, 0, len(keys))
+	for _, key := range keys {
+		k, err := deriveVolatileKey(key)
+		if err != nil {
+			return err
+		}
+		derived = append(derived, k)
+	}
+
+	volatileKeys.Lock()
+	volatileKeys.keys = derived
+	volatileKeys.Unlock()
+	return nil
+}
+
+/*
+SetVolatilePlaintext lets values that are not encrypted be read while volatile
+encryption is on, such as those written before it was turned on. Anyone who
+can write the volatile area can then replace an encrypted value with one of
+their own, so allow it only while migrating.
+*/
+func SetVolatilePlaintext(allow bool) {
+	volatileKeys.Lock()
+	volatileKeys.plaintext = allow
+	volatileKeys.Unlock()
+}
+
+// checkPlaintext rejects an unencrypted volatile document while encryption
+// is on, unless plaintext reads are allowed or the area is empty.
+func checkPlaintext(id string, doc map[string]json.RawMessage) error {
+	volatileKeys.RLock()
+	strict := len(volatileKeys.keys) > 0 && !volatileKeys.plaintext
+	volatileKeys.RUnlock()
+	if !strict {
+		return nil
+	}
+	for field := range doc {
+		if field != "_id" && field != "_rev" {
+			return fmt.Errorf("stream %s: value is not encrypted: %w", id, ErrVolatileTampered)
+		}
+	}
+	return nil
+}
+
+// deriveVolatileKey derives the encryption key and its ID from the private
+// key material with HKDF-SHA256.
+func deriveVolatileKey(key crypto.PrivateKey) (volatileKey, error) {
+	var secret []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		secret = x509.MarshalPKCS1PrivateKey(k)
+	case *bitecdsa.PrivateKey:
+		secret = k.D.Bytes()
+	case *ecdsa.PrivateKey:
+		secret = k.D.Bytes()
+	case ed25519.PrivateKey:
+		secret = k.Seed()
+	default:
+		return volatileKey{}, keyTypeError("volatile encryption", key)
+	}
+
+	block, err := aes.NewCipher(hkdfSHA256(secret, []byte("activeledger volatile key"), 32))
+	if err != nil {
+		return volatileKey{}, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return volatileKey{}, err
+	}
+	id := hex.EncodeToString(hkdfSHA256(secret, []byte("activeledger volatile key id"), 8))
+	return volatileKey{id: id, aead: aead}, nil
+}
+
+// hkdfSHA256 is HKDF (RFC 5869) with SHA-256 and no salt.
+func hkdfSHA256(secret []byte, info []byte, n int) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	var out, block []byte
+	for counter := byte(1); len(out) < n; counter++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(block)
+		expand.Write(info)
+		expand.Write([]byte{counter})
+		block = expand.Sum(nil)
+		out = append(out, block...)
+	}
+	return out[:n]
+}
+
+// sealVolatile encrypts value for stream id when encryption is on, binding
+// the ciphertext to the stream. Otherwise value is returned unchanged.
+func sealVolatile(id string, value interface{}) (interface{}, error) {
+	volatileKeys.RLock()
+	defer volatileKeys.RUnlock()
+	if len(volatileKeys.keys) == 0 {
+		return value, nil
+	}
+	key := volatileKeys.keys[0]
+
+	plain, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, key.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	env := volatileEnvelope{
+		KeyID: key.id,
+		Nonce: nonce,
+		Data:  key.aead.Seal(nil, nonce, plain, []byte(id)),
+	}
+	return map[string]volatileEnvelope{encryptedField: env}, nil
+}
+
+// openVolatile decrypts a volatile document for stream id, keeping its _id
+// and _rev. Documents without an envelope are returned unchanged when
+// checkPlaintext accepts them.
+func openVolatile(id string, doc map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	raw, ok := doc[encryptedField]
+	if !ok {
+		if err := checkPlaintext(id, doc); err != nil {
+			return nil, err
+		}
+		return doc, nil
+	}
+	var env volatileEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, fmt.Errorf("stream %s: %w", id, ErrVolatileTampered)
+	}
+
+	volatileKeys.RLock()
+	var key *volatileKey
+	for i := range volatileKeys.keys {
+		if volatileKeys.keys[i].id == env.KeyID {
+			key = &volatileKeys.keys[i]
+			break
+		}
+	}
+	volatileKeys.RUnlock()
+	if key == nil {
+		return nil, fmt.Errorf("stream %s: key %s: %w", id, env.KeyID, ErrVolatileKeyNotFound)
+	}
+
+	if len(env.Nonce) != key.aead.NonceSize() {
+		return nil, fmt.Errorf("stream %s: %w", id, ErrVolatileTampered)
+	}
+	plain, err := key.aead.Open(nil, env.Nonce, env.Data, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("stream %s: %w", id, ErrVolatileTampered)
+	}
+
+	var value map[string]json.RawMessage
+	if err := json.Unmarshal(plain, &value); err != nil {
+		return nil, fmt.Errorf("stream %s volatile: %w", id, err)
+	}
+	if value == nil {
+		value = make(map[string]json.RawMessage)
+	}
+	for _, field := range []string{"_id", "_rev"} {
+		if v, ok := doc[field]; ok {
+			value[field] = v
+		}
+	}
+	return value, nil
+}
+
+// openVolatileBody decrypts the document in a raw volatile response, inside
+// the "stream" envelope or at the top level.
+func openVolatileBody(id string, body []byte) ([]byte, error) {
+	var outer map[string]json.RawMessage
+	if json.Unmarshal(body, &outer) != nil {
+		return body, nil
+	}
+
+	if inner, ok := outer["stream"]; ok && strings.HasPrefix(string(inner), "{") {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(inner, &doc); err != nil {
+			return body, nil
+		}
+		if _, ok := doc[encryptedField]; !ok {
+			if err := checkPlaintext(id, doc); err != nil {
+				return nil, err
+			}
+			return body, nil
+		}
+		opened, err := openVolatile(id, doc)
+		if err != nil {
+			return nil, err
+		}
+		if outer["stream"], err = json.Marshal(opened); err != nil {
+			return nil, err
+		}
+		return json.Marshal(outer)
+	}
+
+	if _, ok := outer[encryptedField]; !ok {
+		if err := checkPlaintext(id, outer); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}
+	opened, err := openVolatile(id, outer)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(opened)
+}
@@ -0,0 +1,221 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// useVolatileKeys turns volatile encryption on for the test.
+func useVolatileKeys(t *testing.T, keys ...crypto.PrivateKey) {
+	t.Helper()
+	if err := SetVolatileEncryption(keys...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		SetVolatileEncryption()
+		SetVolatilePlaintext(false)
+	})
+}
+
+func testKeys(t *testing.T) map[string]crypto.PrivateKey {
+	t.Helper()
+	ed, err := Ed25519KeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := P256KeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secp, err := EcdsaKeyGen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.PrivateKey{"ed25519": ed, "secp256r1": p256, "secp256k1": secp, "rsa": RsaKeyGen()}
+}
+
+// seal encrypts value for stream id and returns it as the node would store it.
+func seal(t *testing.T, id string, value interface{}) map[string]json.RawMessage {
+	t.Helper()
+	sealed, err := sealVolatile(id, value)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b, err := json.Marshal(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestVolatileSealOpen(t *testing.T) {
+	for name, key := range testKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			useVolatileKeys(t, key)
+			doc := seal(t, "s1", map[string]int{"count": 7})
+			if _, ok := doc[encryptedField]; !ok || len(doc) != 1 {
+				t.Fatalf("sealed document %v, want only %s", doc, encryptedField)
+			}
+			if strings.Contains(string(doc[encryptedField]), "count") {
+				t.Error("sealed document holds the plaintext")
+			}
+
+			doc["_id"], doc["_rev"] = json.RawMessage(`"s1"`), json.RawMessage(`"2-b"`)
+			opened, err := openVolatile("s1", doc)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(opened["count"]) != "7" || string(opened["_rev"]) != `"2-b"` || len(opened) != 3 {
+				t.Errorf("opened %v", opened)
+			}
+		})
+	}
+}
+
+func TestVolatileTampered(t *testing.T) {
+	keys := testKeys(t)
+	useVolatileKeys(t, keys["ed25519"])
+	sealed := seal(t, "s1", map[string]int{"count": 7})
+
+	var env volatileEnvelope
+	if err := json.Unmarshal(sealed[encryptedField], &env); err != nil {
+		t.Fatal(err)
+	}
+	alter := func(fn func(env *volatileEnvelope)) map[string]json.RawMessage {
+		e := env
+		e.Data = append([]byte(nil), env.Data...)
+		fn(&e)
+		b, _ := json.Marshal(e)
+		return map[string]json.RawMessage{encryptedField: b}
+	}
+
+	tests := []struct {
+		name string
+		id   string
+		doc  map[string]json.RawMessage
+		want error
+	}{
+		{"other stream", "s2", sealed, ErrVolatileTampered},
+		{"altered data", "s1", alter(func(e *volatileEnvelope) { e.Data[0] ^= 1 }), ErrVolatileTampered},
+		{"short nonce", "s1", alter(func(e *volatileEnvelope) { e.Nonce = e.Nonce[:4] }), ErrVolatileTampered},
+		{"bad envelope", "s1", map[string]json.RawMessage{encryptedField: json.RawMessage(`"x"`)}, ErrVolatileTampered},
+		{"unknown key", "s1", alter(func(e *volatileEnvelope) { e.KeyID = "0000000000000000" }), ErrVolatileKeyNotFound},
+		{"plaintext", "s1", map[string]json.RawMessage{"count": json.RawMessage(`99`)}, ErrVolatileTampered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := openVolatile(tt.id, tt.doc); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := openVolatile("s1", map[string]json.RawMessage{"_id": json.RawMessage(`"s1"`)}); err != nil {
+		t.Errorf("an empty area should read, got %v", err)
+	}
+	SetVolatilePlaintext(true)
+	if doc, err := openVolatile("s1", map[string]json.RawMessage{"count": json.RawMessage(`99`)}); err != nil || string(doc["count"]) != "99" {
+		t.Errorf("plaintext allowed: got %v, %v", doc, err)
+	}
+}
+
+func TestVolatileKeyRotation(t *testing.T) {
+	keys := testKeys(t)
+	oldKey, newKey := keys["ed25519"], keys["secp256r1"]
+
+	useVolatileKeys(t, oldKey)
+	old := seal(t, "s1", map[string]int{"count": 1})
+
+	useVolatileKeys(t, newKey, oldKey)
+	if doc, err := openVolatile("s1", old); err != nil || string(doc["count"]) != "1" {
+		t.Fatalf("reading with the old key: got %v, %v", doc, err)
+	}
+	fresh := seal(t, "s1", map[string]int{"count": 2})
+	var oldEnv, newEnv volatileEnvelope
+	json.Unmarshal(old[encryptedField], &oldEnv)
+	json.Unmarshal(fresh[encryptedField], &newEnv)
+	if oldEnv.KeyID == newEnv.KeyID {
+		t.Error("writes should use the first key")
+	}
+
+	useVolatileKeys(t, newKey)
+	if _, err := openVolatile("s1", old); !errors.Is(err, ErrVolatileKeyNotFound) {
+		t.Errorf("got %v, want ErrVolatileKeyNotFound", err)
+	}
+}
+
+func TestVolatileEncryptedRoundTrip(t *testing.T) {
+	useVolatileKeys(t, testKeys(t)["ed25519"])
+	n := newVolatileNode(t, `{}`)
+	ctx := context.Background()
+
+	v := NewVolatile[counter](n.URL, "s1", VolatileOptions{})
+	if _, err := v.Update(ctx, func(c counter) (counter, error) {
+		c.Count = 5
+		return c, nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stored := n.stored(t); !strings.HasPrefix(stored, `{"$encrypted":`) {
+		t.Errorf("stored %s, want an envelope", stored)
+	}
+	if c, err := v.Get(ctx); err != nil || c.Count != 5 {
+		t.Errorf("Get = %v, %v, want count 5", c, err)
+	}
+	if r, err := ReadActivityStreamVolatile(ctx, n.URL, "s1"); err != nil || !strings.Contains(mustJSON(t, r), `"count":5`) {
+		t.Errorf("ReadActivityStreamVolatile = %v, %v", r, err)
+	}
+
+	// a writer without the key replaces the value with plaintext
+	n.mu.Lock()
+	n.set(t, `{"count":1000}`)
+	n.mu.Unlock()
+	if _, err := v.Get(ctx); !errors.Is(err, ErrVolatileTampered) {
+		t.Errorf("got %v, want ErrVolatileTampered", err)
+	}
+	if _, err := ReadActivityStreamVolatile(ctx, n.URL, "s1"); !errors.Is(err, ErrVolatileTampered) {
+		t.Errorf("got %v, want ErrVolatileTampered", err)
+	}
+	if r := GetActivityStreamVolatile(n.URL, "s1"); len(r) != 0 {
+		t.Errorf("GetActivityStreamVolatile = %v, want an empty map", r)
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
@@ -0,0 +1,165 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// volatileNode is a node serving one volatile area, wrapped in the "stream"
+// envelope and given a new revision on each write.
+type volatileNode struct {
+	*httptest.Server
+	mu    sync.Mutex
+	doc   map[string]json.RawMessage
+	rev   int
+	posts int
+	// afterPost, when set, runs after each write is stored
+	afterPost func(n *volatileNode)
+}
+
+func newVolatileNode(t *testing.T, doc string) *volatileNode {
+	t.Helper()
+	n := &volatileNode{}
+	n.set(t, doc)
+	n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if r.Method == "POST" {
+			b, _ := io.ReadAll(r.Body)
+			var doc map[string]json.RawMessage
+			if err := json.Unmarshal(b, &doc); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			n.doc = doc
+			n.rev++
+			n.posts++
+			if n.afterPost != nil {
+				n.afterPost(n)
+			}
+			io.WriteString(w, `{}`)
+			return
+		}
+		doc := map[string]json.RawMessage{"_id": json.RawMessage(`"s1"`), "_rev": json.RawMessage(strconv.Quote(strconv.Itoa(n.rev) + "-a"))}
+		for k, v := range n.doc {
+			doc[k] = v
+		}
+		b, _ := json.Marshal(map[string]interface{}{"stream": doc})
+		w.Write(b)
+	}))
+	t.Cleanup(n.Close)
+	return n
+}
+
+// set replaces the stored document as another writer would.
+func (n *volatileNode) set(t *testing.T, doc string) {
+	t.Helper()
+	n.doc = nil
+	if err := json.Unmarshal([]byte(doc), &n.doc); err != nil {
+		t.Fatal(err)
+	}
+	n.rev++
+}
+
+func (n *volatileNode) stored(t *testing.T) string {
+	t.Helper()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	b, err := json.Marshal(n.doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+type counter struct {
+	Count int `json:"count"`
+}
+
+func TestVolatileRoundTrip(t *testing.T) {
+	n := newVolatileNode(t, `{"count":1}`)
+	ctx := context.Background()
+
+	m := NewVolatile[map[string]interface{}](n.URL, "s1", VolatileOptions{})
+	got, err := m.Get(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 1 || got["count"] != 1.0 {
+		t.Errorf("Get = %v, want map[count:1]", got)
+	}
+
+	v := NewVolatile[counter](n.URL, "s1", VolatileOptions{})
+	for i := 0; i < 2; i++ {
+		if _, err := v.Update(ctx, func(c counter) (counter, error) {
+			c.Count++
+			return c, nil
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got, want := n.stored(t), `{"count":3}`; got != want {
+		t.Errorf("stored %s, want %s", got, want)
+	}
+	c, err := v.Get(ctx)
+	if err != nil || c.Count != 3 {
+		t.Errorf("Get = %v, %v, want count 3", c, err)
+	}
+}
+
+func TestVolatileEmpty(t *testing.T) {
+	n := newVolatileNode(t, `{}`)
+	c, err := NewVolatile[counter](n.URL, "s1", VolatileOptions{}).Get(context.Background())
+	if err != nil || c.Count != 0 {
+		t.Errorf("Get = %v, %v, want the zero value", c, err)
+	}
+}
+
+func TestVolatileOverwrittenAfterUpdate(t *testing.T) {
+	n := newVolatileNode(t, `{"count":1}`)
+	n.afterPost = func(n *volatileNode) {
+		n.doc = map[string]json.RawMessage{"count": json.RawMessage(`10`)}
+		n.rev++
+	}
+
+	v := NewVolatile[counter](n.URL, "s1", VolatileOptions{})
+	_, err := v.Update(context.Background(), func(c counter) (counter, error) {
+		c.Count++
+		return c, nil
+	})
+	if !errors.Is(err, ErrVolatileConflict) {
+		t.Errorf("got %v, want ErrVolatileConflict", err)
+	}
+	if n.posts != 1 {
+		t.Errorf("wrote %d times, want 1", n.posts)
+	}
+}
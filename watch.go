@@ -0,0 +1,263 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WatchOptions configures a Watch.
+type WatchOptions struct {
+	// Subscribe configures the live subscription. OnStateChange is still
+	// called.
+	Subscribe SubscribeOptions
+	// Since is the changes feed sequence to start after. When empty the
+	// watch starts from the feed's current position.
+	Since string
+	// BatchSize is the number of changes fetched per request, 100 when zero.
+	BatchSize int
+	// OnError receives errors fetching missed changes. The fetch is retried.
+	OnError func(err error)
+}
+
+// Watch delivers a continuous sequence of stream changes. It follows the
+// live activity subscription and, each time that connects, fills the gap
+// from the /api/stream/changes feed. Changes are delivered once, in revision
+// order for each stream.
+type Watch struct {
+	host      string
+	opts      WatchOptions
+	client    *http.Client
+	sub       *Subscription
+	changes   chan StreamChange
+	connected chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	mu        sync.Mutex
+	since     string
+	delivered map[string]int
+}
+
+// NewWatch starts watching every activity stream on the node at host,
+// host:http://ip:port
+func NewWatch(host string, opts WatchOptions) (*Watch, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	client := opts.Subscribe.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watch{
+		host:      host,
+		opts:      opts,
+		client:    client,
+		changes:   make(chan StreamChange),
+		connected: make(chan struct{}, 1),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		since:     opts.Since,
+		delivered: make(map[string]int),
+	}
+
+	subOpts := opts.Subscribe
+	onState := subOpts.OnStateChange
+	subOpts.OnStateChange = func(state ConnState, err error) {
+		if state == Connected {
+			select {
+			case w.connected <- struct{}{}:
+			default:
+			}
+		}
+		if onState != nil {
+			onState(state, err)
+		}
+	}
+
+	sub, err := NewSubscription(host, ActivityTopic(), subOpts)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	w.sub = sub
+	go w.run()
+	return w, nil
+}
+
+// Changes returns the channel changes are delivered on. It is closed once
+// the watch is closed.
+func (w *Watch) Changes() <-chan StreamChange {
+	return w.changes
+}
+
+// Since returns the changes feed sequence the watch has caught up to.
+func (w *Watch) Since() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.since
+}
+
+// Close stops the watch and its subscription.
+func (w *Watch) Close() error {
+	w.cancel()
+	err := w.sub.Close()
+	<-w.done
+	return err
+}
+
+func (w *Watch) run() {
+	defer close(w.done)
+	defer close(w.changes)
+
+	events := w.sub.Events()
+	var retry <-chan time.Time
+	// After each connect live events are held back until the gap before
+	// them has been filled, so no missed revision is overtaken.
+	filling := false
+	var held []StreamChange
+	for {
+		select {
+		case <-w.connected:
+			filling, retry = true, nil
+		case <-retry:
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			a, err := ParseActivityEvent(ev)
+			if err != nil {
+				continue
+			}
+			// the reconnect may have been signalled while this event waited
+			select {
+			case <-w.connected:
+				filling, retry = true, nil
+			default:
+			}
+			if filling {
+				held = append(held, a.Change())
+			} else if !w.deliver(a.Change()) {
+				return
+			}
+		case <-w.ctx.Done():
+			return
+		}
+
+		if !filling || retry != nil {
+			continue
+		}
+		var ok bool
+		if retry, ok = w.fill(); !ok {
+			return
+		}
+		if retry != nil {
+			continue
+		}
+		filling = false
+		for _, c := range held {
+			if !w.deliver(c) {
+				return
+			}
+		}
+		held = nil
+	}
+}
+
+// fill delivers the changes made since the last known sequence, or when
+// there is none finds the feed's current position. It returns a timer
+// channel when the fetch failed and must be retried, and false when the
+// watch is closing.
+func (w *Watch) fill() (<-chan time.Time, bool) {
+	since := w.Since()
+	if since == "" {
+		pos, err := feedPosition(w.ctx, w.client, w.host)
+		if err != nil {
+			return w.fillFailed(err)
+		}
+		w.setSince(pos)
+		return nil, true
+	}
+
+	for {
+		changes, lastSeq, err := fetchChanges(w.ctx, w.client, w.host, changesQuery(since, w.opts.BatchSize))
+		if err != nil {
+			return w.fillFailed(err)
+		}
+		for _, c := range changes {
+			if !w.deliver(c) {
+				return nil, false
+			}
+		}
+
+		if lastSeq != "" {
+			w.setSince(lastSeq)
+		}
+		if len(changes) < w.opts.BatchSize || lastSeq == "" || lastSeq == since {
+			return nil, true
+		}
+		since = lastSeq
+	}
+}
+
+func (w *Watch) fillFailed(err error) (<-chan time.Time, bool) {
+	if w.ctx.Err() != nil {
+		return nil, false
+	}
+	if w.opts.OnError != nil {
+		w.opts.OnError(err)
+	}
+	return time.After(w.sub.backoff(0)), true
+}
+
+func (w *Watch) setSince(seq string) {
+	w.mu.Lock()
+	w.since = seq
+	w.mu.Unlock()
+}
+
+// deliver sends c unless a newer revision of its stream has already been
+// delivered. It returns false when the watch is closing.
+func (w *Watch) deliver(c StreamChange) bool {
+	gen := c.Generation()
+	if gen > 0 {
+		if last, ok := w.delivered[c.StreamID]; ok && gen <= last {
+			return true
+		}
+		w.delivered[c.StreamID] = gen
+	}
+
+	select {
+	case w.changes <- c:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,164 @@
+/*
+ * MIT License (MIT)
+ * Copyright (c) 2018
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// WatchStream follows a stream on the node set with SetUrl and emits its
+// state, decoded as with DecodeState, each time the stream's revision advances, starting with the
+// current state. The channel is closed when ctx is done.
+//
+// The subscription is connected before the first fetch, so no change made
+// between the two is missed, and the stream is fetched again after every
+// reconnection. Later fetch and decode errors skip the update and are
+// passed to opts.OnError when it is set.
+func WatchStream[T any](ctx context.Context, id string, opts WatchStreamOptions) (<-chan T, error) {
+	host := GetUrl()
+	connected := make(chan struct{}, 1)
+
+	sub, err := NewSubscription(host, StreamTopic(id), SubscribeOptions{
+		OnStateChange: func(state ConnState, err error) {
+			if state == Connected {
+				select {
+				case connected <- struct{}{}:
+				default:
+				}
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-connected:
+	case <-ctx.Done():
+		sub.Close()
+		return nil, ctx.Err()
+	}
+
+	w := &streamWatcher[T]{host: host, id: id, out: make(chan T), onError: opts.OnError}
+	doc, err := fetchStream(ctx, http.DefaultClient, host, id)
+	if err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer sub.Close()
+		defer close(w.out)
+
+		if !w.emit(ctx, doc) {
+			return
+		}
+		for {
+			select {
+			case <-connected:
+				if !w.refetch(ctx) {
+					return
+				}
+			case ev, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				a, err := ParseActivityEvent(ev)
+				if err != nil || (a.Revision != "" && revGeneration(a.Revision) <= w.generation) {
+					continue
+				}
+				if !w.refetch(ctx) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return w.out, nil
+}
+
+// WatchStreamOptions configures WatchStream.
+type WatchStreamOptions struct {
+	// OnError receives errors fetching or decoding the stream. The update
+	// is skipped and the next event or reconnection fetches it again.
+	OnError func(err error)
+}
+
+type streamWatcher[T any] struct {
+	host       string
+	id         string
+	out        chan T
+	onError    func(err error)
+	generation int
+}
+
+func (w *streamWatcher[T]) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
+
+// refetch reads the stream again and emits it if it has changed. A failed
+// fetch is left for the next event or reconnection to retry.
+func (w *streamWatcher[T]) refetch(ctx context.Context) bool {
+	doc, err := fetchStream(ctx, http.DefaultClient, w.host, w.id)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+		w.report(err)
+		return true
+	}
+	return w.emit(ctx, doc)
+}
+
+// emit decodes and sends doc when its revision is newer than the last one
+// sent. It returns false when ctx is done.
+func (w *streamWatcher[T]) emit(ctx context.Context, doc map[string]json.RawMessage) bool {
+	s, err := ParseActivityStream(doc)
+	if err != nil {
+		w.report(err)
+		return true
+	}
+	gen := revGeneration(s.Revision)
+	if gen <= w.generation && w.generation > 0 {
+		return true
+	}
+
+	v, err := DecodeState[T](s)
+	if err != nil {
+		w.report(err)
+		return true
+	}
+	w.generation = gen
+
+	select {
+	case w.out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}